@@ -12,6 +12,7 @@ import (
 	"github.com/hashicorp/inclusify/pkg/gh"
 	"github.com/hashicorp/inclusify/pkg/message"
 	"github.com/hashicorp/inclusify/pkg/pulls"
+	"github.com/hashicorp/inclusify/pkg/remote"
 	"github.com/hashicorp/inclusify/pkg/version"
 )
 
@@ -41,11 +42,25 @@ func inner() error {
 		return err
 	}
 
+	// The GitHub API and HTTPS git remotes share the CA bundle and proxy
 	if cf != nil {
-		client, err = gh.NewBaseGithubInteractor(cf.Token)
+		httpClient, err := gh.NewHTTPClient(cf.CABundle, cf.Proxy)
 		if err != nil {
 			return err
 		}
+		remote.InstallHTTPClient(httpClient)
+
+		// A token isn't required when working on a local checkout
+		if cf.Token != "" {
+			client, err = gh.NewGithubInteractor(cf.Token, gh.ClientOptions{
+				BaseURL:    cf.GithubURL,
+				UploadURL:  cf.GithubUploadURL,
+				HTTPClient: httpClient,
+			})
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	tmpBranch := "update-references"
@@ -54,7 +69,10 @@ func inner() error {
 			return &branches.CreateCommand{Config: cf, GithubClient: client, BranchesList: []string{tmpBranch}}, nil
 		},
 		"updateRefs": func() (cli.Command, error) {
-			return &files.UpdateRefsCommand{Config: cf, GithubClient: client, TempBranch: tmpBranch}, nil
+			return &files.UpdateRefsCommand{Config: cf, GithubClient: client, UI: ui, TempBranch: tmpBranch}, nil
+		},
+		"scan": func() (cli.Command, error) {
+			return &files.ScanCommand{Config: cf, UI: ui}, nil
 		},
 		"updatePulls": func() (cli.Command, error) {
 			return &pulls.UpdateCommand{Config: cf, GithubClient: client}, nil
@@ -3,6 +3,7 @@ package branches
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"time"
 
 	"github.com/google/go-github/v32/github"
@@ -38,8 +39,18 @@ func (c *CreateCommand) Run(args []string) int {
 			return c.exitError(fmt.Errorf("call to get master ref returned error: %w", err))
 		}
 
-		sha := ref.Object.GetSHA()
+		// Re-runs leave the existing branches alone, updateRefs regenerates the changes on top of them
 		targetRef := fmt.Sprintf("refs/heads/%s", branch)
+		existing, res, err := c.GithubClient.GetGit().GetRef(ctx, c.Config.Owner, c.Config.Repo, targetRef)
+		if err == nil {
+			c.Config.Logger.Info(message.Info("Branch already exists, skipping it"), "branch", branch, "sha", existing.GetObject().GetSHA())
+			continue
+		}
+		if res == nil || res.StatusCode != http.StatusNotFound {
+			return c.exitError(fmt.Errorf("call to get %s ref returned error: %w", branch, err))
+		}
+
+		sha := ref.Object.GetSHA()
 		targetRefObj := &github.Reference{
 			Ref: &targetRef,
 			Object: &github.GitObject{
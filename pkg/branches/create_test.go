@@ -70,3 +70,27 @@ func TestCreateBranchRun(t *testing.T) {
 		assert.Equal(t, want[i].Object.GetSHA(), c.Object.GetSHA())
 	}
 }
+
+// Test that re-runs skip the branches that already exist
+func TestCreateBranchRun_Existing(t *testing.T) {
+	ui := cli.NewMockUi()
+	client := gh.NewMockGithubInteractor()
+	config := &config.Config{
+		Owner:  "hashicorp",
+		Repo:   "test",
+		Base:   "master",
+		Target: "main",
+		Token:  "token",
+		Logger: hclog.New(&hclog.LoggerOptions{
+			Output: ui.OutputWriter,
+		}),
+	}
+
+	for i := 0; i < 2; i++ {
+		command := &CreateCommand{Config: config, GithubClient: client, BranchesList: []string{"update-references"}}
+		require.Equal(t, 0, command.Run([]string{}), ui.OutputWriter.String())
+	}
+
+	assert.Len(t, client.CreatedReferences, 2)
+	assert.Contains(t, ui.OutputWriter.String(), "Branch already exists, skipping it: branch=update-references sha="+client.MasterRef)
+}
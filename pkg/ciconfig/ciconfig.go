@@ -0,0 +1,247 @@
+package ciconfig
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Provider is a CI or automation tool whose config can reference branches
+type Provider string
+
+// The providers whose branch references we understand
+const (
+	GitHubActions Provider = "github-actions"
+	CircleCI      Provider = "circleci"
+	Travis        Provider = "travis"
+	GoReleaser    Provider = "goreleaser"
+)
+
+// Range is the [Start, End) byte offsets of a branch name within a config file
+type Range struct {
+	Start int
+	End   int
+}
+
+// Contains returns true if [start, end) lies within the range
+func (r Range) Contains(start, end int) bool {
+	return r.Start <= start && end <= r.End
+}
+
+// Detect returns the provider whose config lives at the slash-separated path,
+// relative to the repo root, or an empty string if it is not a known CI config
+func Detect(rel string) Provider {
+	ext := path.Ext(rel)
+	if ext != ".yml" && ext != ".yaml" {
+		return ""
+	}
+
+	switch {
+	case strings.HasPrefix(rel, ".github/workflows/"):
+		return GitHubActions
+	case strings.HasPrefix(rel, ".circleci/"):
+		return CircleCI
+	case rel == ".travis"+ext:
+		return Travis
+	case rel == ".goreleaser"+ext:
+		return GoReleaser
+	}
+
+	return ""
+}
+
+// BranchRanges parses the config for the given provider, and returns the
+// location of every scalar that names a branch:
+//
+//   - GitHub Actions: on.<event>.branches and on.<event>.branches-ignore
+//   - CircleCI: filters.branches.only and filters.branches.ignore, at any depth
+//   - Travis: branches.only, branches.except and deploy.on.branch
+//   - GoReleaser: release.target_commitish, and the branch of any tap, bucket or repository
+//
+// Only the returned ranges should be rewritten, which leaves everything else in
+// the file, including comments and formatting, exactly as it was.
+func BranchRanges(p Provider, content []byte) ([]Range, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s config: %w", p, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+
+	var nodes []*yaml.Node
+	switch p {
+	case GitHubActions:
+		for _, event := range mappingValues(lookup(root, "on")) {
+			nodes = append(nodes, scalars(lookup(event, "branches"))...)
+			nodes = append(nodes, scalars(lookup(event, "branches-ignore"))...)
+		}
+	case CircleCI:
+		walk(root, func(n *yaml.Node) {
+			branches := lookup(lookup(n, "filters"), "branches")
+			nodes = append(nodes, scalars(lookup(branches, "only"))...)
+			nodes = append(nodes, scalars(lookup(branches, "ignore"))...)
+		})
+	case Travis:
+		branches := lookup(root, "branches")
+		nodes = append(nodes, scalars(lookup(branches, "only"))...)
+		nodes = append(nodes, scalars(lookup(branches, "except"))...)
+		deploy := lookup(root, "deploy")
+		for _, d := range append([]*yaml.Node{deploy}, sequenceItems(deploy)...) {
+			nodes = append(nodes, scalars(lookup(lookup(d, "on"), "branch"))...)
+		}
+	case GoReleaser:
+		nodes = append(nodes, scalars(lookup(lookup(root, "release"), "target_commitish"))...)
+		walk(root, func(n *yaml.Node) {
+			for _, key := range []string{"tap", "bucket", "repository", "index"} {
+				nodes = append(nodes, scalars(lookup(lookup(n, key), "branch"))...)
+			}
+		})
+	default:
+		return nil, fmt.Errorf("unknown CI provider %q", p)
+	}
+
+	lineOffsets := lineStarts(content)
+	var ranges []Range
+	for _, n := range nodes {
+		if r, ok := scalarRange(content, lineOffsets, n); ok {
+			ranges = append(ranges, r)
+		}
+	}
+
+	return ranges, nil
+}
+
+// lookup returns the value for key in a mapping node, following aliases
+func lookup(n *yaml.Node, key string) *yaml.Node {
+	n = resolve(n)
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value == key {
+			return resolve(n.Content[i+1])
+		}
+	}
+	return nil
+}
+
+// mappingValues returns the values of a mapping node
+func mappingValues(n *yaml.Node) []*yaml.Node {
+	n = resolve(n)
+	if n == nil || n.Kind != yaml.MappingNode {
+		return nil
+	}
+	var values []*yaml.Node
+	for i := 1; i < len(n.Content); i += 2 {
+		values = append(values, resolve(n.Content[i]))
+	}
+	return values
+}
+
+// sequenceItems returns the items of a sequence node
+func sequenceItems(n *yaml.Node) []*yaml.Node {
+	n = resolve(n)
+	if n == nil || n.Kind != yaml.SequenceNode {
+		return nil
+	}
+	return n.Content
+}
+
+// scalars returns n if it is a scalar, or its scalar items if it is a sequence
+func scalars(n *yaml.Node) []*yaml.Node {
+	n = resolve(n)
+	if n == nil {
+		return nil
+	}
+	if n.Kind == yaml.ScalarNode {
+		return []*yaml.Node{n}
+	}
+	var out []*yaml.Node
+	for _, item := range sequenceItems(n) {
+		if item = resolve(item); item.Kind == yaml.ScalarNode {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// walk calls fn for every node in the tree, without following aliases
+func walk(n *yaml.Node, fn func(*yaml.Node)) {
+	if n == nil {
+		return
+	}
+	fn(n)
+	for _, child := range n.Content {
+		walk(child, fn)
+	}
+}
+
+func resolve(n *yaml.Node) *yaml.Node {
+	if n != nil && n.Kind == yaml.AliasNode {
+		return n.Alias
+	}
+	return n
+}
+
+// lineStarts returns the byte offset of the start of each line
+func lineStarts(content []byte) []int {
+	starts := []int{0}
+	for i, b := range content {
+		if b == '\n' {
+			starts = append(starts, i+1)
+		}
+	}
+	return starts
+}
+
+// scalarRange returns the byte range of a single-line scalar's value in content,
+// excluding any quotes. Block scalars and multi-line values are never branch
+// names, so they are ignored.
+func scalarRange(content []byte, lineOffsets []int, n *yaml.Node) (Range, bool) {
+	if n.Line < 1 || n.Line > len(lineOffsets) || n.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 {
+		return Range{}, false
+	}
+
+	// yaml.v3 counts columns in runes, so walk the line to find the byte offset
+	lineStart := lineOffsets[n.Line-1]
+	lineEnd := len(content)
+	if n.Line < len(lineOffsets) {
+		lineEnd = lineOffsets[n.Line] - 1
+	}
+	start := lineStart
+	for col := 1; col < n.Column && start < lineEnd; col++ {
+		_, size := utf8.DecodeRune(content[start:lineEnd])
+		start += size
+	}
+	line := content[start:lineEnd]
+
+	switch {
+	case n.Style&yaml.DoubleQuotedStyle != 0, n.Style&yaml.SingleQuotedStyle != 0:
+		quote := line[0]
+		for i := 1; i < len(line); i++ {
+			if quote == '"' && line[i] == '\\' {
+				i++
+				continue
+			}
+			if line[i] == quote {
+				if quote == '\'' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					continue
+				}
+				return Range{Start: start + 1, End: start + i}, true
+			}
+		}
+		return Range{}, false
+	default:
+		if !bytes.HasPrefix(line, []byte(n.Value)) {
+			return Range{}, false
+		}
+		return Range{Start: start, End: start + len(n.Value)}, true
+	}
+}
@@ -0,0 +1,96 @@
+// +build !integration
+
+package ciconfig
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// branchValues returns the text at each of the ranges
+func branchValues(content []byte, ranges []Range) []string {
+	var values []string
+	for _, r := range ranges {
+		values = append(values, string(content[r.Start:r.End]))
+	}
+	return values
+}
+
+// Test that CI configs are detected from their path
+func Test_Detect(t *testing.T) {
+	assert.Equal(t, GitHubActions, Detect(".github/workflows/ci-tester.yml"))
+	assert.Equal(t, CircleCI, Detect(".circleci/config/workflows/ci.yml"))
+	assert.Equal(t, Travis, Detect(".travis.yaml"))
+	assert.Equal(t, GoReleaser, Detect(".goreleaser.yml"))
+	assert.Equal(t, Provider(""), Detect(".teamcity.yml"))
+	assert.Equal(t, Provider(""), Detect(".circleci/Makefile"))
+}
+
+// Test that only branch filters are found in each of the fake repo's CI configs
+func Test_BranchRanges_FakeRepo(t *testing.T) {
+	cases := map[string][]string{
+		".circleci/config.yml":              {"master"},
+		".circleci/config/workflows/ci.yml": {"master"},
+		".circleci/config/jobs/test.yml":    nil,
+		".github/workflows/ci-tester.yml":   nil,
+		".travis.yaml":                      nil,
+		".goreleaser.yml":                   nil,
+	}
+
+	for rel, want := range cases {
+		content, err := ioutil.ReadFile(filepath.Join("..", "tests", "fakeRepo", filepath.FromSlash(rel)))
+		require.NoError(t, err)
+
+		ranges, err := BranchRanges(Detect(rel), content)
+		require.NoError(t, err, rel)
+		assert.Equal(t, want, branchValues(content, ranges), rel)
+	}
+}
+
+// Test that the branch filters of Travis and GoReleaser configs are found, but not
+// the other mentions of the branch
+func Test_BranchRanges_Testdata(t *testing.T) {
+	cases := map[string][]string{
+		"travis/.travis.yml":         {"master"},
+		"goreleaser/.goreleaser.yml": {"master", "master"},
+	}
+
+	for rel, want := range cases {
+		content, err := ioutil.ReadFile(filepath.Join("testdata", filepath.FromSlash(rel)))
+		require.NoError(t, err)
+
+		ranges, err := BranchRanges(Detect(filepath.Base(rel)), content)
+		require.NoError(t, err, rel)
+		assert.Equal(t, want, branchValues(content, ranges), rel)
+	}
+}
+
+// Test that flow sequences, quotes and non-ASCII text are handled
+func Test_BranchRanges_GitHubActions(t *testing.T) {
+	content := []byte(`name: "Grüße master"
+on:
+  push:
+    branches: [master, 'release/*']
+  pull_request:
+    branches-ignore:
+      - "master" # the old default
+jobs:
+  build:
+    steps:
+      - run: git push origin master
+`)
+
+	ranges, err := BranchRanges(GitHubActions, content)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"master", "release/*", "master"}, branchValues(content, ranges))
+}
+
+// Test that invalid YAML is reported
+func Test_BranchRanges_Invalid(t *testing.T) {
+	_, err := BranchRanges(CircleCI, []byte("jobs: [unclosed"))
+	assert.Error(t, err)
+}
@@ -2,23 +2,100 @@ package config
 
 import (
 	"fmt"
+	"io"
 	"strings"
 
 	hclog "github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/inclusify/pkg/matcher"
 	"github.com/hashicorp/inclusify/pkg/message"
+	"github.com/hashicorp/inclusify/pkg/pathspec"
+	"github.com/hashicorp/inclusify/pkg/presets"
+	"github.com/hashicorp/inclusify/pkg/remote"
+	"github.com/hashicorp/inclusify/pkg/signing"
+	"github.com/hashicorp/inclusify/pkg/terms"
 	"github.com/mitchellh/cli"
 	nflag "github.com/namsral/flag"
 )
 
+// CIPreset is the list of include patterns used by --ci-only, covering the
+// config files of the CI and automation providers we know about
+var CIPreset = []string{
+	".circleci/",
+	".github/workflows/",
+	".travis.y*ml",
+	".teamcity.yml",
+	".goreleaser.y*ml",
+	"Jenkinsfile",
+	".gitlab-ci.yml",
+	"azure-pipelines.yml",
+}
+
+// DefaultExclusion is always excluded from reference updates, after any
+// --exclusion patterns. Files like go.mod are excluded by the presets instead,
+// so they can be re-included.
+var DefaultExclusion = []string{".git/"}
+
+// Identity is the name and email of the author or committer of a commit
+type Identity struct {
+	Name  string
+	Email string
+}
+
+// String formats the identity like git does, e.g. 'inclusify <inclusify@users.noreply.github.com>'
+func (i Identity) String() string {
+	return fmt.Sprintf("%s <%s>", i.Name, i.Email)
+}
+
+// DefaultIdentity is used for commits when no author is configured
+var DefaultIdentity = Identity{Name: "inclusify", Email: "inclusify@users.noreply.github.com"}
+
 // Config is a struct that contains user inputs and our logger
 type Config struct {
-	Owner     string
-	Repo      string
-	Base      string
-	Target    string
-	Token     string
-	Exclusion []string
-	Logger    hclog.Logger
+	Owner             string
+	Repo              string
+	Base              string
+	Target            string
+	Token             string
+	GithubURL         string
+	GithubUploadURL   string
+	GitHost           string
+	CABundle          string
+	Proxy             string
+	GitAuth           string
+	RemoteURL         string
+	SSHKey            string
+	SSHKeyPassphrase  string
+	SSHKnownHosts     string
+	Exclusion         []string
+	Presets           []string
+	Include           []string
+	StructuredCI      bool
+	Path              string
+	LocalBranch       string
+	WorkspaceDir      string
+	InMemoryObjects   bool
+	CloneDepth        int
+	Terms             []terms.Entry
+	MatchMode         matcher.Mode
+	CaseSensitive     bool
+	Allowlist         []string
+	MaxFileSize       int64
+	Workers           int
+	DryRun            bool
+	Interactive       bool
+	SingleCommit      bool
+	Author            Identity
+	Committer         Identity
+	SignOff           bool
+	SigningKey        string
+	SigningFormat     string
+	SigningPassphrase string
+	CheckLinks        bool
+	Submodules        bool
+	PatchFile         string
+	Format            string
+	Output            string
+	Logger            hclog.Logger
 }
 
 // ParseAndValidate parses the cmd line flags / env vars, and verifies that all required
@@ -26,9 +103,16 @@ type Config struct {
 // with the prefix 'INCLUSIFY_'. If both values are set, the env var value will be used.
 func ParseAndValidate(args []string, ui cli.Ui) (c *Config, err error) {
 	var (
-		owner, repo, token, base, target, exclusion string
+		owner, repo, token, base, target, exclusion, matchMode, allowlist, patchFile, presetList, include, termsFile, localPath, localBranch, format, output string
+		authorName, authorEmail, committerName, committerEmail, signingKey, signingFormat, signingPassphrase                                                 string
+		workspaceDir, githubURL, githubUploadURL, gitHost, caBundle, proxy                                                                                   string
+		gitAuth, remoteURL, sshKey, sshKeyPassphrase, sshKnownHosts                                                                                          string
 	)
-	var exclusionArr []string
+	var dryRun, singleCommit, signOff, inMemoryObjects, ciOnly, structuredCI, interactive, caseSensitive, checkLinks, submodules bool
+	var exclusionArr, includeArr, allowlistArr []string
+	var termsArr []terms.Entry
+	var maxFileSize int64
+	var workers, cloneDepth int
 
 	// Values can be passed in to the subcommands as inputs flags,
 	// or set as env vars with the prefix "INCLUSIFY_"
@@ -38,7 +122,48 @@ func ParseAndValidate(args []string, ui cli.Ui) (c *Config, err error) {
 	flags.StringVar(&base, "base", "master", "The name of the current base branch, e.g. 'master'")
 	flags.StringVar(&target, "target", "main", "The name of the target branch, e.g. 'main'")
 	flags.StringVar(&token, "token", "", "Your Personal GitHub Access Token")
-	flags.StringVar(&exclusion, "exclusion", "", "Paths to exclude from reference updates, e.g. '.circleci/config.yml,.teamcity.yml'")
+	flags.StringVar(&githubURL, "github-url", "", "The API URL of a GitHub Enterprise Server, e.g. 'https://github.example.com/api/v3/', defaults to github.com")
+	flags.StringVar(&githubUploadURL, "github-upload-url", "", "The uploads API URL of the GitHub Enterprise Server, defaults to the one on the host of --github-url")
+	flags.StringVar(&gitHost, "git-host", "", "The host of the git remotes, defaults to the host of --github-url, or github.com")
+	flags.StringVar(&caBundle, "ca-bundle", "", "Path to a PEM file of CA certificates to trust in addition to the system's, e.g. for an internal GitHub Enterprise Server")
+	flags.StringVar(&proxy, "proxy", "", "The URL of the proxy for GitHub API and HTTPS git requests, defaults to the HTTPS_PROXY env var")
+	flags.StringVar(&gitAuth, "git-auth", remote.AuthToken, "How to authenticate git clones and pushes: 'token', 'ssh-key', 'ssh-agent' or 'credential-helper'")
+	flags.StringVar(&remoteURL, "remote-url", "", "Template of the git remote URL, e.g. 'ssh://git@github.com/{owner}/{repo}.git', defaults to HTTPS or SSH on github.com depending on --git-auth")
+	flags.StringVar(&sshKey, "ssh-key", "", "With --git-auth=ssh-key, path to the private key to clone and push with, e.g. a deploy key")
+	flags.StringVar(&sshKeyPassphrase, "ssh-key-passphrase", "", "The passphrase of the SSH key, if it is protected")
+	flags.StringVar(&sshKnownHosts, "ssh-known-hosts", "", "Path to the known_hosts file used to verify the remote's host key, defaults to ~/.ssh/known_hosts")
+	flags.StringVar(&exclusion, "exclusion", "", "Gitignore-style patterns of paths to exclude from reference updates, e.g. '.circleci/,!.circleci/config.yml,/docs/**/*.md'")
+	flags.StringVar(&presetList, "presets", presets.Auto, "Exclusion presets to apply, e.g. 'node,terraform', 'auto' to detect them from the repo, or 'none'")
+	flags.StringVar(&include, "include", "", "Gitignore-style patterns of the only paths to update, e.g. 'Makefile,scripts/'")
+	flags.BoolVar(&ciOnly, "ci-only", false, "Only update CI and automation config files, in addition to any --include patterns")
+	flags.BoolVar(&structuredCI, "structured-ci", false, "Only rewrite branch filters in known CI configs, leaving the rest of those files untouched")
+	flags.StringVar(&termsFile, "terms", "", "Path to a JSON dictionary of additional terms to replace, e.g. 'terms.json'")
+	flags.StringVar(&matchMode, "match-mode", string(matcher.ModeIdentifier), "How references are matched: 'identifier', 'word' or 'substring'")
+	flags.BoolVar(&caseSensitive, "case-sensitive", false, "Only match references with the exact case of each term, instead of matching any case and preserving it")
+	flags.StringVar(&allowlist, "allowlist", "", "Phrases that must never be rewritten, e.g. 'master key,mastermind'")
+	flags.Int64Var(&maxFileSize, "max-file-size", 1<<20, "Files larger than this many bytes are skipped, 0 disables the limit")
+	flags.IntVar(&workers, "workers", 0, "How many files are read and rewritten at once, 0 uses the number of CPUs")
+	flags.StringVar(&localPath, "path", "", "Update the working tree at this local path instead of cloning the repo, e.g. '.'")
+	flags.StringVar(&localBranch, "local-branch", "", "With --path, commit the changes to this new local branch instead of leaving them uncommitted")
+	flags.StringVar(&workspaceDir, "workspace-dir", "", "The dir that repos are cloned into, defaults to the OS temp dir")
+	flags.BoolVar(&inMemoryObjects, "in-memory-objects", false, "Keep the git objects and refs of cloned repos in memory, still checking out their files to --workspace-dir")
+	flags.IntVar(&cloneDepth, "clone-depth", 0, "Shallow clone repos to this many commits, 0 clones the whole history")
+	flags.BoolVar(&checkLinks, "check-links", true, "Only rewrite links to other GitHub repos if the new branch exists in them")
+	flags.BoolVar(&submodules, "submodules", false, "Also migrate submodules owned by the same org, and open linked PRs in them")
+	flags.BoolVar(&dryRun, "dry-run", false, "Show the changes as a diff instead of pushing them and opening a PR")
+	flags.BoolVar(&singleCommit, "single-commit", false, "Commit all changes at once, instead of a commit per category: CI, docs, scripts, source code and other")
+	flags.StringVar(&authorName, "author-name", DefaultIdentity.Name, "The name of the author of the commits")
+	flags.StringVar(&authorEmail, "author-email", DefaultIdentity.Email, "The email of the author of the commits")
+	flags.StringVar(&committerName, "committer-name", "", "The name of the committer of the commits, defaults to the author's")
+	flags.StringVar(&committerEmail, "committer-email", "", "The email of the committer of the commits, defaults to the author's")
+	flags.BoolVar(&signOff, "signoff", false, "Add a DCO 'Signed-off-by' trailer for the committer to each commit")
+	flags.StringVar(&signingKey, "signing-key", "", "Path to a private key to sign the commits with, e.g. '~/.ssh/id_ed25519'")
+	flags.StringVar(&signingFormat, "signing-format", signing.FormatOpenPGP, "The format of the signing key: 'openpgp' (or 'gpg') or 'ssh'")
+	flags.StringVar(&signingPassphrase, "signing-passphrase", "", "The passphrase of the signing key, if it is protected")
+	flags.BoolVar(&interactive, "interactive", false, "Review each change, and only commit the ones that are accepted")
+	flags.StringVar(&patchFile, "patch-file", "", "With --dry-run, write the changes to this patch file instead of printing them")
+	flags.StringVar(&format, "format", "text", "The format of the scan report: 'text', 'json', 'csv' or 'sarif'")
+	flags.StringVar(&output, "output", "", "Write the scan report to this file instead of printing it")
 
 	// Special check for ./inclusify invocation without any args
 	// Return the help message
@@ -64,33 +189,170 @@ func ParseAndValidate(args []string, ui cli.Ui) (c *Config, err error) {
 		return c, fmt.Errorf("error parsing inputs: %w", err)
 	}
 
-	if owner == "" || repo == "" || token == "" {
+	// Scanning, or working on a local checkout with updateRefs, doesn't touch GitHub at all
+	localOnly := cmd == "scan" || (cmd == "updateRefs" && localPath != "")
+	if !localOnly && (owner == "" || repo == "" || token == "") {
 		return c, fmt.Errorf(
 			"%s\npass in all required flags or set environment variables with the 'INCLUSIFY_' prefix.\nRun [subcommand] --help to view required inputs",
 			message.Error("required inputs are missing"),
 		)
 	}
 
+	if cmd == "scan" && localPath == "" {
+		localPath = "."
+	}
+
 	if len(exclusion) > 0 {
 		exclusionArr = strings.Split(exclusion, ",")
 	}
-	exclusionArr = append(exclusionArr, ".git/", "go.mod", "go.sum")
+	exclusionArr = append(exclusionArr, DefaultExclusion...)
+	if _, err := pathspec.Compile(exclusionArr); err != nil {
+		return c, fmt.Errorf("error parsing exclusion: %w", err)
+	}
+
+	// Presets are resolved once the repo is cloned, since they may be detected from its files
+	var presetArr []string
+	for _, name := range strings.Split(presetList, ",") {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			presetArr = append(presetArr, name)
+		}
+	}
+	if err := presets.Validate(presetArr); err != nil {
+		return c, fmt.Errorf("error parsing presets: %w", err)
+	}
+
+	if len(include) > 0 {
+		includeArr = strings.Split(include, ",")
+	}
+	if ciOnly {
+		includeArr = append(includeArr, CIPreset...)
+	}
+	if _, err := pathspec.Compile(includeArr); err != nil {
+		return c, fmt.Errorf("error parsing include: %w", err)
+	}
+
+	if workers < 0 {
+		return c, fmt.Errorf("error parsing workers: must not be negative, got %d", workers)
+	}
+
+	if cloneDepth < 0 {
+		return c, fmt.Errorf("error parsing clone-depth: must not be negative, got %d", cloneDepth)
+	}
 
+	if committerName == "" {
+		committerName = authorName
+	}
+	if committerEmail == "" {
+		committerEmail = authorEmail
+	}
+	if signOff && (committerName == "" || committerEmail == "") {
+		return c, fmt.Errorf("error parsing signoff: the committer name and email must be set")
+	}
+	signingFormat, err = signing.ParseFormat(signingFormat)
+	if err != nil {
+		return c, err
+	}
+
+	if gitHost == "" {
+		gitHost, err = remote.Host(githubURL)
+		if err != nil {
+			return c, err
+		}
+	}
+
+	gitAuth, err = remote.ParseMethod(gitAuth)
+	if err != nil {
+		return c, err
+	}
+	if gitAuth == remote.AuthSSHKey && sshKey == "" && !localOnly {
+		return c, fmt.Errorf("error parsing git-auth: --ssh-key must be set to use '%s'", remote.AuthSSHKey)
+	}
+
+	mode, err := matcher.ParseMode(matchMode)
+	if err != nil {
+		return c, err
+	}
+
+	if termsFile != "" {
+		termsArr, err = terms.Load(termsFile)
+		if err != nil {
+			return c, err
+		}
+	}
+
+	if len(allowlist) > 0 {
+		allowlistArr = strings.Split(allowlist, ",")
+	}
+
+	// Keep the scan report on stdout machine-readable by logging to stderr
+	var logOutput io.Writer = &cli.UiWriter{Ui: ui}
+	if cmd == "scan" {
+		logOutput = &uiErrorWriter{ui: ui}
+	}
 	logger := hclog.New(&hclog.LoggerOptions{
 		Name:   "inclusify",
 		Level:  hclog.LevelFromString("INFO"),
-		Output: &cli.UiWriter{Ui: ui},
+		Output: logOutput,
 	})
 
 	c = &Config{
-		Owner:     owner,
-		Repo:      repo,
-		Base:      base,
-		Target:    target,
-		Token:     token,
-		Exclusion: exclusionArr,
-		Logger:    logger,
+		Owner:             owner,
+		Repo:              repo,
+		Base:              base,
+		Target:            target,
+		Token:             token,
+		GithubURL:         githubURL,
+		GithubUploadURL:   githubUploadURL,
+		GitHost:           gitHost,
+		CABundle:          caBundle,
+		Proxy:             proxy,
+		GitAuth:           gitAuth,
+		RemoteURL:         remoteURL,
+		SSHKey:            sshKey,
+		SSHKeyPassphrase:  sshKeyPassphrase,
+		SSHKnownHosts:     sshKnownHosts,
+		Exclusion:         exclusionArr,
+		Presets:           presetArr,
+		Include:           includeArr,
+		StructuredCI:      structuredCI,
+		Path:              localPath,
+		LocalBranch:       localBranch,
+		WorkspaceDir:      workspaceDir,
+		InMemoryObjects:   inMemoryObjects,
+		CloneDepth:        cloneDepth,
+		Terms:             termsArr,
+		MatchMode:         mode,
+		CaseSensitive:     caseSensitive,
+		Allowlist:         allowlistArr,
+		MaxFileSize:       maxFileSize,
+		Workers:           workers,
+		DryRun:            dryRun,
+		Interactive:       interactive,
+		SingleCommit:      singleCommit,
+		Author:            Identity{Name: authorName, Email: authorEmail},
+		Committer:         Identity{Name: committerName, Email: committerEmail},
+		SignOff:           signOff,
+		SigningKey:        signingKey,
+		SigningFormat:     signingFormat,
+		SigningPassphrase: signingPassphrase,
+		CheckLinks:        checkLinks,
+		Submodules:        submodules,
+		PatchFile:         patchFile,
+		Format:            format,
+		Output:            output,
+		Logger:            logger,
 	}
 
 	return c, nil
 }
+
+// uiErrorWriter is an io.Writer that writes to the UI's error channel, like
+// cli.UiWriter does for its output channel
+type uiErrorWriter struct {
+	ui cli.Ui
+}
+
+func (w *uiErrorWriter) Write(p []byte) (n int, err error) {
+	w.ui.Error(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
@@ -10,6 +10,8 @@ import (
 	"github.com/mitchellh/cli"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/inclusify/pkg/matcher"
 )
 
 // Test that the config is generated properly when only env vars are set
@@ -26,7 +28,7 @@ func Test_ParseAndValidate_EnvVars(t *testing.T) {
 	ui := &cli.BasicUi{}
 	config, err := ParseAndValidate(args, ui)
 	require.NoError(t, err)
-	exclusionArr = append(exclusionArr, ".git/", "go.mod", "go.sum")
+	exclusionArr = append(exclusionArr, ".git/")
 
 	// Make some assertions about the UI output
 	assert.Equal(t, os.Getenv("INCLUSIFY_OWNER"), config.Owner)
@@ -53,7 +55,7 @@ func Test_ParseAndValidate_Flags(t *testing.T) {
 	exclusionArr := strings.Split(exclusion, ",")
 
 	args := []string{"subcommand", "--owner", owner, "--repo", repo, "--token", token, "--exclusion", exclusion}
-	exclusionArr = append(exclusionArr, ".git/", "go.mod", "go.sum")
+	exclusionArr = append(exclusionArr, ".git/")
 
 	ui := &cli.BasicUi{}
 	config, err := ParseAndValidate(args, ui)
@@ -65,4 +67,66 @@ func Test_ParseAndValidate_Flags(t *testing.T) {
 	assert.Equal(t, "main", config.Target)
 	assert.Equal(t, token, config.Token)
 	assert.Equal(t, exclusionArr, config.Exclusion)
+	assert.Equal(t, matcher.ModeIdentifier, config.MatchMode)
+}
+
+// Test that scan doesn't require a token, and scans the current dir by default
+func Test_ParseAndValidate_Scan(t *testing.T) {
+	os.Unsetenv("INCLUSIFY_OWNER")
+	os.Unsetenv("INCLUSIFY_REPO")
+	os.Unsetenv("INCLUSIFY_TOKEN")
+
+	ui := &cli.BasicUi{}
+	config, err := ParseAndValidate([]string{"scan", "--format", "csv"}, ui)
+	require.NoError(t, err)
+	assert.Equal(t, ".", config.Path)
+	assert.Equal(t, "csv", config.Format)
+
+	_, err = ParseAndValidate([]string{"updateRefs"}, ui)
+	assert.Error(t, err)
+}
+
+// Test that the git auth method is validated, and that an SSH key is required to use one
+func Test_ParseAndValidate_GitAuth(t *testing.T) {
+	os.Unsetenv("INCLUSIFY_GIT_AUTH")
+	os.Unsetenv("INCLUSIFY_SSH_KEY")
+
+	ui := &cli.BasicUi{}
+	args := []string{"updateRefs", "--owner", "hashicorp", "--repo", "inclusify", "--token", "github_token"}
+	config, err := ParseAndValidate(args, ui)
+	require.NoError(t, err)
+	assert.Equal(t, "token", config.GitAuth)
+
+	_, err = ParseAndValidate(append(args, "--git-auth", "ssh-key"), ui)
+	assert.Error(t, err)
+
+	config, err = ParseAndValidate(append(args, "--git-auth", "ssh-key", "--ssh-key", "id_ed25519", "--remote-url", "ssh://git@example.com/{owner}/{repo}"), ui)
+	require.NoError(t, err)
+	assert.Equal(t, "ssh-key", config.GitAuth)
+	assert.Equal(t, "id_ed25519", config.SSHKey)
+	assert.Equal(t, "ssh://git@example.com/{owner}/{repo}", config.RemoteURL)
+
+	_, err = ParseAndValidate(append(args, "--git-auth", "password"), ui)
+	assert.Error(t, err)
+}
+
+// Test that the git host defaults to the host of the GitHub Enterprise Server
+func Test_ParseAndValidate_Enterprise(t *testing.T) {
+	os.Unsetenv("INCLUSIFY_GITHUB_URL")
+	os.Unsetenv("INCLUSIFY_GIT_HOST")
+
+	ui := &cli.BasicUi{}
+	args := []string{"updateRefs", "--owner", "hashicorp", "--repo", "inclusify", "--token", "github_token"}
+	config, err := ParseAndValidate(args, ui)
+	require.NoError(t, err)
+	assert.Equal(t, "github.com", config.GitHost)
+
+	config, err = ParseAndValidate(append(args, "--github-url", "https://github.example.com/api/v3/"), ui)
+	require.NoError(t, err)
+	assert.Equal(t, "https://github.example.com/api/v3/", config.GithubURL)
+	assert.Equal(t, "github.example.com", config.GitHost)
+
+	config, err = ParseAndValidate(append(args, "--github-url", "https://api.example.com/", "--git-host", "git.example.com"), ui)
+	require.NoError(t, err)
+	assert.Equal(t, "git.example.com", config.GitHost)
 }
@@ -0,0 +1,243 @@
+package files
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	git "github.com/go-git/go-git/v5"
+	plumbing "github.com/go-git/go-git/v5/plumbing"
+	object "github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/hashicorp/inclusify/pkg/config"
+	"github.com/hashicorp/inclusify/pkg/pathspec"
+	"github.com/hashicorp/inclusify/pkg/signing"
+)
+
+// Categories of changed files. Each category is committed separately, in this
+// order, so that it can be reviewed and reverted on its own.
+const (
+	CategoryCI      = "ci"
+	CategoryDocs    = "docs"
+	CategoryScripts = "scripts"
+	CategorySource  = "source"
+	CategoryOther   = "other"
+)
+
+// Categories lists every category in the order they are committed
+var Categories = []string{CategoryCI, CategoryDocs, CategoryScripts, CategorySource, CategoryOther}
+
+// categoryTitles describe what each category holds, in commit messages and PR bodies
+var categoryTitles = map[string]string{
+	CategoryCI:      "CI configuration",
+	CategoryDocs:    "documentation",
+	CategoryScripts: "scripts",
+	CategorySource:  "source code",
+	CategoryOther:   "other files",
+}
+
+// ciSpec matches the same CI and automation configs as --ci-only
+var ciSpec, _ = pathspec.Compile(config.CIPreset)
+
+var (
+	docsExts    = []string{".md", ".markdown", ".mdx", ".rst", ".adoc", ".asciidoc", ".txt", ".html", ".htm"}
+	docsNames   = []string{"README", "CHANGELOG", "CONTRIBUTING", "LICENSE", "NOTICE", "AUTHORS", "CODEOWNERS"}
+	docsDirs    = []string{"docs", "doc", "website"}
+	scriptExts  = []string{".sh", ".bash", ".zsh", ".fish", ".ps1", ".psm1", ".bat", ".cmd", ".mk"}
+	scriptNames = []string{"Makefile", "GNUmakefile", "Rakefile", "Justfile", "Taskfile.yml"}
+	scriptDirs  = []string{"scripts", "script", "bin", "hack"}
+	sourceExts  = []string{
+		".go", ".py", ".rb", ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".java", ".kt", ".kts", ".scala",
+		".groovy", ".c", ".h", ".cc", ".cpp", ".cxx", ".hpp", ".cs", ".rs", ".swift", ".m", ".php", ".pl",
+		".lua", ".ex", ".exs", ".erl", ".hs", ".clj", ".dart", ".vue", ".svelte", ".tf", ".hcl", ".sql",
+	}
+)
+
+// Categorize returns the category of the file at the slash-separated path,
+// relative to the repo root. CI configs come first, so a workflow under docs/
+// is still CI configuration, then docs, scripts and source code by name.
+func Categorize(rel string) string {
+	name := path.Base(rel)
+	ext := strings.ToLower(path.Ext(name))
+	dirs := strings.Split(path.Dir(rel), "/")
+
+	switch {
+	case ciSpec.Match(rel, false):
+		return CategoryCI
+	case contains(docsExts, ext) || contains(docsNames, strings.TrimSuffix(name, path.Ext(name))) || contains(docsDirs, dirs[0]):
+		return CategoryDocs
+	case contains(scriptExts, ext) || contains(scriptNames, name) || contains(scriptDirs, dirs[0]):
+		return CategoryScripts
+	case contains(sourceExts, ext):
+		return CategorySource
+	}
+
+	return CategoryOther
+}
+
+// ByCategory groups the changed files by category
+func (r *Result) ByCategory() map[string][]FileChange {
+	groups := map[string][]FileChange{}
+	for _, change := range r.Changed {
+		category := Categorize(change.Path)
+		groups[category] = append(groups[category], change)
+	}
+	return groups
+}
+
+// commitChanges stages and commits the changed files in repo, with a commit per
+// category, unless `INCLUSIFY_SINGLE_COMMIT` is set. It returns the commits in
+// the order they were made.
+func commitChanges(c *config.Config, repo *git.Repository, result *Result) (commits []plumbing.Hash, err error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get worktree: %w", err)
+	}
+	cm, err := newCommitter(c)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := map[string][]FileChange{"": result.Changed}
+	order := []string{""}
+	if !c.SingleCommit {
+		groups = result.ByCategory()
+		order = Categories
+	}
+
+	for _, category := range order {
+		changes := groups[category]
+		if len(changes) == 0 {
+			continue
+		}
+		for _, change := range changes {
+			if _, err := worktree.Add(change.Path); err != nil {
+				return nil, fmt.Errorf("failed to `git add %s`: %w", change.Path, err)
+			}
+		}
+
+		commitMsg := fmt.Sprintf("Update references from %s to %s", c.Base, c.Target)
+		if category != "" {
+			commitMsg += " in " + categoryTitles[category]
+		}
+		c.Logger.Info("Committing changes", "category", category, "files", len(changes))
+		sha, err := cm.commit(repo, worktree, commitMsg)
+		if err != nil {
+			return nil, err
+		}
+		commits = append(commits, sha)
+	}
+
+	return commits, nil
+}
+
+// committer creates commits with the configured author and committer, adding a
+// DCO sign-off and a GPG or SSH signature if configured. go-git signs with the
+// GPG key as it commits, while SSH signatures are added afterwards.
+type committer struct {
+	config *config.Config
+	gpgKey *openpgp.Entity
+	signer signing.Signer
+}
+
+func newCommitter(c *config.Config) (cm *committer, err error) {
+	cm = &committer{config: c}
+	switch {
+	case c.SigningKey == "":
+		return cm, nil
+	case c.SigningFormat == signing.FormatSSH:
+		cm.signer, err = signing.LoadSSH(c.SigningKey, c.SigningPassphrase)
+	default:
+		cm.gpgKey, err = signing.LoadOpenPGP(c.SigningKey, c.SigningPassphrase)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Logger.Info("Signing commits", "format", c.SigningFormat, "key", c.SigningKey)
+
+	return cm, nil
+}
+
+// commit commits the changes staged in worktree, which belongs to repo
+func (cm *committer) commit(repo *git.Repository, worktree *git.Worktree, msg string) (sha plumbing.Hash, err error) {
+	c := cm.config
+	if c.SignOff {
+		msg += fmt.Sprintf("\n\nSigned-off-by: %s", c.Committer)
+	}
+
+	now := time.Now()
+	sha, err = worktree.Commit(msg, &git.CommitOptions{
+		Author:    &object.Signature{Name: c.Author.Name, Email: c.Author.Email, When: now},
+		Committer: &object.Signature{Name: c.Committer.Name, Email: c.Committer.Email, When: now},
+		SignKey:   cm.gpgKey,
+	})
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to commit changes: %w", err)
+	}
+	if cm.signer == nil {
+		return sha, nil
+	}
+
+	return cm.sign(repo, sha)
+}
+
+// sign replaces the commit at HEAD with a copy of it signed with the SSH key,
+// and returns the new commit. go-git can only sign commits with GPG keys, so
+// the SSHSIG signature is added to the commit after it is made, before it is
+// pushed.
+func (cm *committer) sign(repo *git.Repository, sha plumbing.Hash) (signed plumbing.Hash, err error) {
+	commit, err := repo.CommitObject(sha)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to retrieve commit %s: %w", sha, err)
+	}
+
+	unsigned := &plumbing.MemoryObject{}
+	if err := commit.Encode(unsigned); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to encode commit %s: %w", sha, err)
+	}
+	r, err := unsigned.Reader()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	defer r.Close()
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+
+	commit.PGPSignature, err = cm.signer.Sign(content)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	obj := repo.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to encode signed commit: %w", err)
+	}
+	signed, err = repo.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to store signed commit: %w", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to retrieve HEAD commit: %w", err)
+	}
+	err = repo.Storer.SetReference(plumbing.NewHashReference(head.Name(), signed))
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to update %s to the signed commit: %w", head.Name().Short(), err)
+	}
+
+	return signed, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
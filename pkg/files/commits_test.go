@@ -0,0 +1,32 @@
+// +build !integration
+
+package files
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that files are categorized by path, with CI configs taking precedence
+func Test_Categorize(t *testing.T) {
+	cases := map[string]string{
+		".github/workflows/docs.yml": CategoryCI,
+		".circleci/config.yml":       CategoryCI,
+		"Jenkinsfile":                CategoryCI,
+		"README.md":                  CategoryDocs,
+		"LICENSE":                    CategoryDocs,
+		"docs/api/index.yml":         CategoryDocs,
+		"Makefile":                   CategoryScripts,
+		"scripts/release.py":         CategoryScripts,
+		"build/test.sh":              CategoryScripts,
+		"pkg/files/walk.go":          CategorySource,
+		"web/src/app.tsx":            CategorySource,
+		"deploy/values.yaml":         CategoryOther,
+		"Dockerfile":                 CategoryOther,
+	}
+
+	for rel, want := range cases {
+		assert.Equal(t, want, Categorize(rel), rel)
+	}
+}
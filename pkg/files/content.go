@@ -0,0 +1,133 @@
+package files
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Reasons why a file is skipped during reference updates
+const (
+	SkipBinary    = "binary"
+	SkipLFS       = "git-lfs pointer"
+	SkipOversize  = "too large"
+	SkipGenerated = "generated"
+	SkipSymlink   = "symlink"
+	SkipInvalidCI = "invalid CI config"
+)
+
+// sniffLen is how much of a file is inspected when detecting binary content,
+// which is the same heuristic git itself uses
+const sniffLen = 8000
+
+// lfsPointerPrefix is the first line of every Git LFS pointer file
+var lfsPointerPrefix = []byte("version https://git-lfs.github.com/spec/")
+
+// generatedHeader matches the conventional markers left by code generators,
+// e.g. '// Code generated by stringer; DO NOT EDIT.' or '@generated'
+var generatedHeader = regexp.MustCompile(`(?m)^\s*(//|#|--|/\*|\*|<!--).*(Code generated .* DO NOT EDIT\.|@generated\b)`)
+
+// SkippedFile is a file that was left untouched during the reference updates
+type SkippedFile struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+// skipReasonForFile returns why a file should be skipped based on its metadata
+// alone, or an empty string if its contents should be inspected. Vendored code
+// is left to the exclusion patterns and presets, so it can be re-included.
+func skipReasonForFile(fi os.FileInfo, maxSize int64) string {
+	if fi.Mode()&os.ModeSymlink != 0 {
+		return SkipSymlink
+	}
+	if maxSize > 0 && fi.Size() > maxSize {
+		return SkipOversize
+	}
+	return ""
+}
+
+// skipReasonForContent returns why a file should be skipped based on its
+// contents, or an empty string if it is safe to rewrite
+func skipReasonForContent(content []byte) string {
+	if bytes.HasPrefix(content, lfsPointerPrefix) {
+		return SkipLFS
+	}
+
+	sniff := content
+	if len(sniff) > sniffLen {
+		sniff = sniff[:sniffLen]
+	}
+	if bytes.IndexByte(sniff, 0) >= 0 {
+		return SkipBinary
+	}
+	if generatedHeader.Match(sniff) {
+		return SkipGenerated
+	}
+
+	return ""
+}
+
+// readFile reads the file at path, which is size bytes long, or returns why it
+// should be skipped based on its contents. Only its start is read until it is
+// known to be text, so large binaries and Git LFS objects are never loaded whole.
+func readFile(path string, size int64) (content []byte, skip string, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	// Read the whole file into a single buffer, starting with enough to sniff it
+	head := sniffLen + len(bomUTF8)
+	content = make([]byte, head, max(head, int(size)+bytes.MinRead))
+	n, err := io.ReadFull(f, content)
+	content = content[:n]
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, "", err
+	}
+	// UTF-16 can only be checked once decoded, which needs the whole file
+	if !bytes.HasPrefix(content, bomUTF16LE) && !bytes.HasPrefix(content, bomUTF16BE) {
+		if reason := skipReasonForContent(bytes.TrimPrefix(content, bomUTF8)); reason != "" {
+			return nil, reason, nil
+		}
+	}
+	if err == nil {
+		buf := bytes.NewBuffer(content)
+		if _, err = buf.ReadFrom(f); err != nil {
+			return nil, "", err
+		}
+		content = buf.Bytes()
+	}
+
+	return content, "", nil
+}
+
+// writeFile atomically replaces the contents of the file at path, keeping its
+// permissions and executable bits
+func writeFile(path string, content []byte, mode os.FileMode) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".inclusify-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,81 @@
+// +build !integration
+
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that binary, LFS and generated contents are detected
+func Test_SkipReasonForContent(t *testing.T) {
+	cases := map[string]string{
+		"on:\n  push:\n    branches: [master]\n":                                   "",
+		"\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDRmaster":                               SkipBinary,
+		"version https://git-lfs.github.com/spec/v1\noid sha256:abc\nsize 12345\n": SkipLFS,
+		"// Code generated by stringer; DO NOT EDIT.\n\npackage master\n":          SkipGenerated,
+		"# @generated by a tool\nbranch: master\n":                                 SkipGenerated,
+		"The README mentions @generated and Code generated files.\n":               "",
+	}
+
+	for content, want := range cases {
+		assert.Equal(t, want, skipReasonForContent([]byte(content)), content)
+	}
+}
+
+// Test that oversized and symlinked files are detected
+func Test_SkipReasonForFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inclusify-content")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "config.yml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("branch: master\n"), 0644))
+	fi, err := os.Lstat(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, "", skipReasonForFile(fi, 0))
+	assert.Equal(t, "", skipReasonForFile(fi, 1024))
+	assert.Equal(t, SkipOversize, skipReasonForFile(fi, 4))
+
+	link := filepath.Join(dir, "link.yml")
+	require.NoError(t, os.Symlink(path, link))
+	fi, err = os.Lstat(link)
+	require.NoError(t, err)
+	assert.Equal(t, SkipSymlink, skipReasonForFile(fi, 0))
+}
+
+// Test that files are read whole, unless their start shows they should be skipped
+func Test_ReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inclusify-content")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cases := map[string]struct {
+		content string
+		skip    string
+	}{
+		"empty.txt":  {"", ""},
+		"small.txt":  {"branch: master\n", ""},
+		"large.txt":  {strings.Repeat("master\n", 3*sniffLen), ""},
+		"binary.bin": {"\x89PNG\r\n\x1a\n\x00" + strings.Repeat("master", 3*sniffLen), SkipBinary},
+		"utf16.txt":  {string(encodeText([]byte(strings.Repeat("master\n", sniffLen)), encodingUTF16LE)), ""},
+	}
+	for name, tc := range cases {
+		path := filepath.Join(dir, name)
+		require.NoError(t, ioutil.WriteFile(path, []byte(tc.content), 0644))
+
+		content, skip, err := readFile(path, int64(len(tc.content)))
+		require.NoError(t, err, name)
+		assert.Equal(t, tc.skip, skip, name)
+		if tc.skip == "" {
+			assert.Equal(t, tc.content, string(content), name)
+		}
+	}
+}
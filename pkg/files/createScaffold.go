@@ -3,7 +3,6 @@ package files
 import (
 	"context"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"time"
@@ -13,13 +12,12 @@ import (
 	"github.com/hashicorp/inclusify/pkg/config"
 	"github.com/hashicorp/inclusify/pkg/gh"
 	"github.com/hashicorp/inclusify/pkg/message"
+	"github.com/hashicorp/inclusify/pkg/workspace"
 	"github.com/otiai10/copy"
 
 	git "github.com/go-git/go-git/v5"
 	gitConfig "github.com/go-git/go-git/v5/config"
 	plumbing "github.com/go-git/go-git/v5/plumbing"
-	object "github.com/go-git/go-git/v5/plumbing/object"
-	http "github.com/go-git/go-git/v5/plumbing/transport/http"
 )
 
 // CreateScaffoldCommand is a struct used to configure a Command for creating
@@ -30,37 +28,35 @@ type CreateScaffoldCommand struct {
 	TempBranch   string
 }
 
-// InitializeRepo creates a temp directory and initializes it as a new repo
-func InitializeRepo(c *CreateScaffoldCommand) (repoRef *git.Repository, dir string, err error) {
-	pwd, err := os.Getwd()
-	if err != nil {
-		return nil, "", fmt.Errorf("failed to get current working directory: %w", err)
-	}
-
+// InitializeRepo creates a workspace and initializes a new repo in it. The
+// workspace must be closed once it's no longer needed.
+func InitializeRepo(c *CreateScaffoldCommand) (ws *workspace.Workspace, err error) {
 	prefix := fmt.Sprintf("tmp-clone-%s", uniuri.NewLen(6))
-	c.Config.Logger.Info("Creating local temp dir", "dirPrefix", prefix)
-	dir, err = ioutil.TempDir(pwd, prefix)
+	c.Config.Logger.Info("Creating workspace", "dirPrefix", prefix, "inMemoryObjects", c.Config.InMemoryObjects)
+	ws, err = workspace.New(workspaceOptions(c.Config), prefix)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to create tmp directory: %w", err)
+		return nil, err
 	}
 
-	c.Config.Logger.Info("Initializing new repo at dir", "dir", dir)
-	repo, err := git.PlainInit(dir, false)
+	c.Config.Logger.Info("Initializing new repo at dir", "dir", ws.Dir)
+	err = ws.Init()
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to initialize new repo: %w", err)
+		ws.Close()
+		return nil, err
 	}
 
 	c.Config.Logger.Info("Creating a new remote for base", "base", c.Config.Base)
-	url := fmt.Sprintf("https://github.com/%s/%s.git", c.Config.Owner, c.Config.Repo)
-	_, err = repo.CreateRemote((&gitConfig.RemoteConfig{
+	url := remoteOptions(c.Config).URL(c.Config.Owner, c.Config.Repo)
+	_, err = ws.Repo.CreateRemote((&gitConfig.RemoteConfig{
 		Name: "master",
 		URLs: []string{url},
 	}))
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to create remote: %w", err)
+		ws.Close()
+		return nil, fmt.Errorf("failed to create remote: %w", err)
 	}
 
-	return repo, dir, nil
+	return ws, nil
 }
 
 // CopyCIFiles copies the files from tests/fakeRepo/* into the temp-dir
@@ -100,13 +96,13 @@ func GitPushCommit(c *CreateScaffoldCommand, repo *git.Repository) (err error) {
 
 	c.Config.Logger.Info("Committing changes")
 	commitMsg := "Creating initial commit"
-	commitSha, err := worktree.Commit(commitMsg, &git.CommitOptions{
-		Author: &object.Signature{
-			When: time.Now(),
-		},
-	})
+	cm, err := newCommitter(c.Config)
+	if err != nil {
+		return err
+	}
+	commitSha, err := cm.commit(repo, worktree, commitMsg)
 	if err != nil {
-		return fmt.Errorf("failed to commit changes: %w", err)
+		return err
 	}
 
 	// Create a new refspec in order to push to $base for the first time
@@ -116,14 +112,15 @@ func GitPushCommit(c *CreateScaffoldCommand, repo *git.Repository) (err error) {
 	referenceList := append([]gitConfig.RefSpec{},
 		gitConfig.RefSpec(upstreamReference+":"+downstreamReference))
 
+	auth, err := remoteAuth(c.Config, repo, "master")
+	if err != nil {
+		return err
+	}
 	c.Config.Logger.Info("Pushing initial commit to remote", "branch", c.Config.Base, "sha", commitSha)
 	err = repo.Push(&git.PushOptions{
 		RemoteName: "master",
 		RefSpecs:   referenceList,
-		Auth: &http.BasicAuth{
-			Username: "irrelevant", // This cannot be an empty string
-			Password: c.Config.Token,
-		},
+		Auth:       auth,
 	})
 	if err != nil {
 		return fmt.Errorf("failed to push changes: %w", err)
@@ -163,17 +160,18 @@ func CreateBranchProtection(c *CreateScaffoldCommand) (err error) {
 
 // Run creates an initial commit in the $base of the repo, e.g. 'master'
 func (c *CreateScaffoldCommand) Run(args []string) int {
-	repo, dir, err := InitializeRepo(c)
+	ws, err := InitializeRepo(c)
 	if err != nil {
 		return c.exitError(err)
 	}
+	defer ws.Close()
 
-	err = CopyCIFiles(c, dir)
+	err = CopyCIFiles(c, ws.Dir)
 	if err != nil {
 		return c.exitError(err)
 	}
 
-	err = GitPushCommit(c, repo)
+	err = GitPushCommit(c, ws.Repo)
 	if err != nil {
 		return c.exitError(err)
 	}
@@ -183,8 +181,6 @@ func (c *CreateScaffoldCommand) Run(args []string) int {
 		return c.exitError(err)
 	}
 
-	defer os.RemoveAll(dir)
-
 	return 0
 }
 
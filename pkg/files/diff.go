@@ -0,0 +1,348 @@
+package files
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+
+	plumbing "github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/hashicorp/inclusify/pkg/message"
+)
+
+// diffContext is the number of unchanged lines shown around each change
+const diffContext = 3
+
+// diffOp is a single line in an edit script
+type diffOp struct {
+	kind byte // ' ', '-' or '+'
+	line string
+}
+
+// UnifiedDiff returns the changes from a to b in unified diff format, as used
+// by `git diff` and accepted by `git apply`. If color is true, removed lines are
+// red, added lines are green and hunk headers are cyan.
+func UnifiedDiff(path string, a, b []byte, color bool) string {
+	ops := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	header := fmt.Sprintf("diff --git a/%s b/%s\n--- a/%s\n+++ b/%s\n", path, path, path, path)
+	if color {
+		header = message.Info(header)
+	}
+	out.WriteString(header)
+
+	// Track the current line number in a and b for each op
+	aLine, bLine := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	aLine[0], bLine[0] = 1, 1
+	for i, op := range ops {
+		aLine[i+1], bLine[i+1] = aLine[i], bLine[i]
+		if op.kind != '+' {
+			aLine[i+1]++
+		}
+		if op.kind != '-' {
+			bLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+
+		// Grow the hunk until there are more than 2*diffContext unchanged lines in a row
+		start := max(0, i-diffContext)
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(ops) && ops[run].kind == ' ' {
+				run++
+			}
+			if run == len(ops) || run-end > 2*diffContext {
+				end = min(run, end+diffContext)
+				break
+			}
+			end = run
+		}
+
+		aCount, bCount := 0, 0
+		for _, op := range ops[start:end] {
+			if op.kind != '+' {
+				aCount++
+			}
+			if op.kind != '-' {
+				bCount++
+			}
+		}
+		hunk := fmt.Sprintf("@@ -%s +%s @@\n", hunkRange(aLine[start], aCount), hunkRange(bLine[start], bCount))
+		if color {
+			hunk = message.Info(hunk)
+		}
+		out.WriteString(hunk)
+
+		for _, op := range ops[start:end] {
+			line := string(op.kind) + op.line
+			if !strings.HasSuffix(op.line, "\n") {
+				line += "\n\\ No newline at end of file\n"
+			}
+			switch {
+			case color && op.kind == '-':
+				line = message.Error(line)
+			case color && op.kind == '+':
+				line = message.Success(line)
+			}
+			out.WriteString(line)
+		}
+
+		i = end
+	}
+
+	return out.String()
+}
+
+// BinaryDiff returns the change from a to b as a git binary patch, which `git
+// apply` accepts for files that cannot be patched line by line, e.g. UTF-16 files
+func BinaryDiff(path string, a, b []byte) string {
+	var out strings.Builder
+	fmt.Fprintf(&out, "diff --git a/%s b/%s\nindex %s..%s\nGIT binary patch\n", path, path,
+		plumbing.ComputeHash(plumbing.BlobObject, a), plumbing.ComputeHash(plumbing.BlobObject, b))
+	// The forward hunk is followed by the reverse one, so the patch can be reverted
+	writeBinaryHunk(&out, b)
+	writeBinaryHunk(&out, a)
+	return out.String()
+}
+
+// writeBinaryHunk writes content as a 'literal' hunk: deflated, then base85
+// encoded in lines of at most 52 bytes, each prefixed with its length
+func writeBinaryHunk(out *strings.Builder, content []byte) {
+	var deflated bytes.Buffer
+	w := zlib.NewWriter(&deflated)
+	w.Write(content)
+	w.Close()
+
+	fmt.Fprintf(out, "literal %d\n", len(content))
+	for data := deflated.Bytes(); len(data) > 0; {
+		n := min(len(data), 52)
+		if n <= 26 {
+			out.WriteByte(byte('A' + n - 1))
+		} else {
+			out.WriteByte(byte('a' + n - 27))
+		}
+		encodeBase85(out, data[:n])
+		out.WriteByte('\n')
+		data = data[n:]
+	}
+	out.WriteByte('\n')
+}
+
+// base85 is the alphabet of git's base85 encoding
+const base85 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz!#$%&()*+-;<=>?@^_`{|}~"
+
+// encodeBase85 writes each group of 4 bytes of data, zero padded, as 5 characters
+func encodeBase85(out *strings.Builder, data []byte) {
+	for i := 0; i < len(data); i += 4 {
+		var acc uint32
+		for j := 0; j < 4; j++ {
+			acc <<= 8
+			if i+j < len(data) {
+				acc |= uint32(data[i+j])
+			}
+		}
+		var group [5]byte
+		for j := 4; j >= 0; j-- {
+			group[j] = base85[acc%85]
+			acc /= 85
+		}
+		out.Write(group[:])
+	}
+}
+
+// hunkRange formats the start and length of one side of a hunk header
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, count)
+}
+
+// splitLines splits content into lines, keeping the line endings
+func splitLines(content []byte) []string {
+	var lines []string
+	for len(content) > 0 {
+		i := bytes.IndexByte(content, '\n')
+		if i < 0 {
+			lines = append(lines, string(content))
+			break
+		}
+		lines = append(lines, string(content[:i+1]))
+		content = content[i+1:]
+	}
+	return lines
+}
+
+// diffLines returns an edit script that turns a into b. Rewrites never add or
+// remove lines, so when a and b have as many lines they are paired one-to-one.
+// Otherwise, the shortest edit script is found with the linear space variant of
+// the Myers diff algorithm.
+func diffLines(a, b []string) []diffOp {
+	if len(a) != len(b) {
+		return myersDiff(nil, a, b)
+	}
+
+	ops := make([]diffOp, 0, len(a))
+	for i := 0; i < len(a); {
+		if a[i] == b[i] {
+			ops = append(ops, diffOp{kind: ' ', line: a[i]})
+			i++
+			continue
+		}
+		// Show a run of changed lines as removals followed by additions, like git
+		end := i
+		for end < len(a) && a[end] != b[end] {
+			end++
+		}
+		for _, line := range a[i:end] {
+			ops = append(ops, diffOp{kind: '-', line: line})
+		}
+		for _, line := range b[i:end] {
+			ops = append(ops, diffOp{kind: '+', line: line})
+		}
+		i = end
+	}
+	return ops
+}
+
+// myersDiff appends the shortest edit script that turns a into b to ops. It
+// splits both inputs at the middle snake and recurses, so only O(len(a)+len(b))
+// memory is used.
+func myersDiff(ops []diffOp, a, b []string) []diffOp {
+	for len(a) > 0 && len(b) > 0 && a[0] == b[0] {
+		ops = append(ops, diffOp{kind: ' ', line: a[0]})
+		a, b = a[1:], b[1:]
+	}
+	suffix := 0
+	for suffix < len(a) && suffix < len(b) && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	common := a[len(a)-suffix:]
+	a, b = a[:len(a)-suffix], b[:len(b)-suffix]
+
+	switch {
+	case len(a) == 0:
+		for _, line := range b {
+			ops = append(ops, diffOp{kind: '+', line: line})
+		}
+	case len(b) == 0:
+		for _, line := range a {
+			ops = append(ops, diffOp{kind: '-', line: line})
+		}
+	default:
+		x, y := middleSnake(a, b)
+		ops = myersDiff(ops, a[:x], b[:y])
+		ops = myersDiff(ops, a[x:], b[y:])
+	}
+
+	for _, line := range common {
+		ops = append(ops, diffOp{kind: ' ', line: line})
+	}
+	return ops
+}
+
+// middleSnake returns where the shortest edit script that turns a into b is split
+// in two, by searching for it from both ends at once until the paths overlap. a
+// and b must not be empty.
+func middleSnake(a, b []string) (x, y int) {
+	n, m := len(a), len(b)
+	maxD := (n + m + 1) / 2
+	offset := maxD + 1
+	forward, backward := make([]int, 2*offset+1), make([]int, 2*offset+1)
+	for i := range forward {
+		forward[i], backward[i] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+
+	// If the difference in length is odd, the paths overlap on a forward step
+	delta := n - m
+	odd := delta%2 != 0
+	// Diagonals that run off the edge of the grid are no longer searched
+	kStartF, kEndF, kStartB, kEndB := 0, 0, 0, 0
+
+	for d := 0; d < maxD; d++ {
+		for k := -d + kStartF; k <= d-kEndF; k += 2 {
+			var x int
+			if k == -d || (k != d && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			forward[offset+k] = x
+			switch {
+			case x > n:
+				kEndF += 2
+			case y > m:
+				kStartF += 2
+			case odd:
+				if i := offset + delta - k; i >= 0 && i < len(backward) && backward[i] != -1 && x >= n-backward[i] {
+					return x, y
+				}
+			}
+		}
+
+		// The backward search runs on the reversed inputs
+		for k := -d + kStartB; k <= d-kEndB; k += 2 {
+			var x int
+			if k == -d || (k != d && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[n-x-1] == b[m-y-1] {
+				x++
+				y++
+			}
+			backward[offset+k] = x
+			switch {
+			case x > n:
+				kEndB += 2
+			case y > m:
+				kStartB += 2
+			case !odd:
+				if i := offset + delta - k; i >= 0 && i < len(forward) && forward[i] != -1 && forward[i] >= n-x {
+					return forward[i], forward[i] - (delta - k)
+				}
+			}
+		}
+	}
+
+	// Nothing in common, so every line of a is removed and every line of b added
+	return n, 0
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,148 @@
+// +build !integration
+
+package files
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+
+	plumbing "github.com/go-git/go-git/v5/plumbing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that distant changes are split into separate hunks with context
+func Test_UnifiedDiff(t *testing.T) {
+	var a, b []string
+	for i := 1; i <= 20; i++ {
+		a = append(a, fmt.Sprintf("line %d\n", i))
+		b = append(b, fmt.Sprintf("line %d\n", i))
+	}
+	a[1], b[1] = "master\n", "main\n"
+	b[17] = "inserted\nline 18\n"
+
+	diff := UnifiedDiff("README.md", []byte(strings.Join(a, "")), []byte(strings.Join(b, "")+"no newline"), false)
+	assert.Equal(t, `diff --git a/README.md b/README.md
+--- a/README.md
++++ b/README.md
+@@ -1,5 +1,5 @@
+ line 1
+-master
++main
+ line 3
+ line 4
+ line 5
+@@ -15,6 +15,8 @@
+ line 15
+ line 16
+ line 17
++inserted
+ line 18
+ line 19
+ line 20
++no newline
+\ No newline at end of file
+`, diff)
+}
+
+// Test that identical contents produce no hunks
+func Test_UnifiedDiff_NoChanges(t *testing.T) {
+	diff := UnifiedDiff("a.txt", []byte("same\n"), []byte("same\n"), false)
+	assert.Equal(t, "diff --git a/a.txt b/a.txt\n--- a/a.txt\n+++ b/a.txt\n", diff)
+}
+
+// Test that rewritten lines are paired one-to-one, with a run of changes shown as
+// removals followed by additions
+func Test_diffLines_Rewrite(t *testing.T) {
+	ops := diffLines([]string{"a\n", "master\n", "master\n", "b\n"}, []string{"a\n", "main\n", "main\n", "b\n"})
+	assert.Equal(t, []diffOp{
+		{' ', "a\n"}, {'-', "master\n"}, {'-', "master\n"}, {'+', "main\n"}, {'+', "main\n"}, {' ', "b\n"},
+	}, ops)
+}
+
+// Test that edit scripts turn a into b with as few edits as the longest common
+// subsequence allows, on random inputs with lines added and removed
+func Test_diffLines_Shortest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		a, b := make([]string, r.Intn(30)), make([]string, r.Intn(30))
+		for j := range a {
+			a[j] = fmt.Sprintf("%d\n", r.Intn(4))
+		}
+		for j := range b {
+			b[j] = fmt.Sprintf("%d\n", r.Intn(4))
+		}
+		if len(a) == len(b) {
+			b = append(b, "extra\n")
+		}
+
+		var gotA, gotB []string
+		edits := 0
+		for _, op := range diffLines(a, b) {
+			if op.kind != '+' {
+				gotA = append(gotA, op.line)
+			}
+			if op.kind != '-' {
+				gotB = append(gotB, op.line)
+			}
+			if op.kind != ' ' {
+				edits++
+			}
+		}
+		require.Equal(t, a, nonNil(gotA), "a=%q b=%q", a, b)
+		require.Equal(t, b, nonNil(gotB), "a=%q b=%q", a, b)
+		require.Equal(t, len(a)+len(b)-2*lcs(a, b), edits, "a=%q b=%q", a, b)
+	}
+}
+
+func nonNil(lines []string) []string {
+	if lines == nil {
+		return []string{}
+	}
+	return lines
+}
+
+// lcs returns the length of the longest common subsequence of a and b
+func lcs(a, b []string) int {
+	prev, cur := make([]int, len(b)+1), make([]int, len(b)+1)
+	for i := range a {
+		for j := range b {
+			switch {
+			case a[i] == b[j]:
+				cur[j+1] = prev[j] + 1
+			case prev[j+1] > cur[j]:
+				cur[j+1] = prev[j+1]
+			default:
+				cur[j+1] = cur[j]
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// Test that bytes are encoded with git's base85 alphabet, padding partial groups
+func Test_encodeBase85(t *testing.T) {
+	for in, want := range map[string]string{"\xff\xff\xff\xff": "|NsC0", "inclusify": "X>Ma|b#rNEc>n+a"} {
+		var out strings.Builder
+		encodeBase85(&out, []byte(in))
+		assert.Equal(t, want, out.String(), in)
+	}
+}
+
+// Test that UTF-16 files are shown decoded, but patched as binary so that the
+// patch applies to their actual bytes
+func Test_Result_Diff_UTF16(t *testing.T) {
+	original := encodeText([]byte("Push to master\n"), encodingUTF16LE)
+	updated := encodeText([]byte("Push to main\n"), encodingUTF16LE)
+	result := &Result{Changed: []FileChange{{Path: "notes.txt", original: original, updated: updated}}}
+
+	assert.Contains(t, result.Diff(true), "+Push to main\n")
+
+	patch := result.Diff(false)
+	assert.True(t, strings.HasPrefix(patch, fmt.Sprintf("diff --git a/notes.txt b/notes.txt\nindex %s..%s\nGIT binary patch\nliteral %d\n",
+		plumbing.ComputeHash(plumbing.BlobObject, original), plumbing.ComputeHash(plumbing.BlobObject, updated), len(updated))), patch)
+	assert.Contains(t, patch, fmt.Sprintf("\n\nliteral %d\n", len(original)))
+}
@@ -0,0 +1,109 @@
+package files
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// textEncoding is the encoding a file was read in, so that it can be written
+// back the same way. Line endings are never touched, since references are
+// replaced in place, so CRLF files stay CRLF.
+type textEncoding int
+
+const (
+	encodingUTF8 textEncoding = iota
+	encodingUTF8BOM
+	encodingUTF16LE
+	encodingUTF16BE
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// errOddUTF16 is returned for content that has a UTF-16 byte order mark, but
+// cannot be UTF-16 text
+var errOddUTF16 = errors.New("content has a UTF-16 byte order mark but an odd length")
+
+// decodeText strips any byte order mark from content, and converts UTF-16
+// content to UTF-8 so it can be matched like any other file
+func decodeText(content []byte) (text []byte, enc textEncoding, err error) {
+	switch {
+	case bytes.HasPrefix(content, bomUTF8):
+		return content[len(bomUTF8):], encodingUTF8BOM, nil
+	case bytes.HasPrefix(content, bomUTF16LE):
+		text, err = decodeUTF16(content[len(bomUTF16LE):], binary.LittleEndian)
+		return text, encodingUTF16LE, err
+	case bytes.HasPrefix(content, bomUTF16BE):
+		text, err = decodeUTF16(content[len(bomUTF16BE):], binary.BigEndian)
+		return text, encodingUTF16BE, err
+	}
+	return content, encodingUTF8, nil
+}
+
+// encodeText is the inverse of decodeText
+func encodeText(text []byte, enc textEncoding) []byte {
+	switch enc {
+	case encodingUTF8BOM:
+		return append(append([]byte{}, bomUTF8...), text...)
+	case encodingUTF16LE:
+		return append(append([]byte{}, bomUTF16LE...), encodeUTF16(text, binary.LittleEndian)...)
+	case encodingUTF16BE:
+		return append(append([]byte{}, bomUTF16BE...), encodeUTF16(text, binary.BigEndian)...)
+	}
+	return text
+}
+
+func decodeUTF16(content []byte, order binary.ByteOrder) ([]byte, error) {
+	if len(content)%2 != 0 {
+		return nil, errOddUTF16
+	}
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		units[i] = order.Uint16(content[2*i:])
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(units))
+	for _, r := range utf16.Decode(units) {
+		b.WriteRune(r)
+	}
+	return b.Bytes(), nil
+}
+
+func encodeUTF16(text []byte, order binary.ByteOrder) []byte {
+	runes := make([]rune, 0, utf8.RuneCount(text))
+	for len(text) > 0 {
+		r, size := utf8.DecodeRune(text)
+		runes = append(runes, r)
+		text = text[size:]
+	}
+
+	units := utf16.Encode(runes)
+	out := make([]byte, 2*len(units))
+	for i, u := range units {
+		order.PutUint16(out[2*i:], u)
+	}
+	return out
+}
+
+// displayText returns content as UTF-8 for showing to humans, keeping any
+// UTF-8 byte order mark so that patches still apply
+func displayText(content []byte) []byte {
+	text, enc, err := decodeText(content)
+	if err != nil || enc == encodingUTF8 || enc == encodingUTF8BOM {
+		return content
+	}
+	return text
+}
+
+// isUTF16 returns true if content is UTF-16 text, which git can only patch as binary
+func isUTF16(content []byte) bool {
+	_, enc, err := decodeText(content)
+	return err == nil && (enc == encodingUTF16LE || enc == encodingUTF16BE)
+}
@@ -0,0 +1,103 @@
+package files
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/inclusify/pkg/links"
+	"github.com/hashicorp/inclusify/pkg/matcher"
+)
+
+// FlaggedLink is a link to another repo that contains a reference, but was left
+// untouched because rewriting it could break the link
+type FlaggedLink struct {
+	Path   string
+	Line   int
+	URL    string
+	Reason string
+}
+
+// checkLinks drops the matches that fall inside links to other GitHub repos,
+// unless the match is in the ref of the link and the rewritten ref exists in
+// that repo, e.g. 'github.com/other/repo/blob/master/README.md' is only rewritten
+// if other/repo has a 'main' branch. Links to the repo being updated are always
+// rewritten. Every dropped link is returned so it can be checked manually.
+func (c *UpdateRefsCommand) checkLinks(resolver *links.Resolver, rel string, text []byte, matches []matcher.Match) (kept []matcher.Match, flagged []FlaggedLink) {
+	found := links.FindOnHost(text, c.Config.GitHost)
+	if len(found) == 0 {
+		return matches, nil
+	}
+
+	// Group the matches in the links to other repos by link
+	inLink := map[int][]matcher.Match{}
+	linkOf := map[int]int{}
+	for _, match := range matches {
+		for i, l := range found {
+			if !l.Contains(match.Start, match.End) {
+				continue
+			}
+			if strings.EqualFold(l.Owner, c.Config.Owner) && strings.EqualFold(l.Repo, c.Config.Repo) {
+				break
+			}
+			inLink[i] = append(inLink[i], match)
+			linkOf[match.Start] = i
+			break
+		}
+	}
+	if len(inLink) == 0 {
+		return matches, nil
+	}
+
+	rewrite := map[int]bool{}
+	for i, l := range found {
+		linkMatches, ok := inLink[i]
+		if !ok {
+			continue
+		}
+		reason := c.checkLink(resolver, l, linkMatches)
+		if reason == "" {
+			rewrite[i] = true
+			continue
+		}
+		flagged = append(flagged, FlaggedLink{Path: rel, Line: linkMatches[0].Line, URL: l.URL(text), Reason: reason})
+	}
+
+	for _, match := range matches {
+		if i, ok := linkOf[match.Start]; ok && !rewrite[i] {
+			continue
+		}
+		kept = append(kept, match)
+	}
+
+	return kept, flagged
+}
+
+// checkLink returns why the matches in a link to another repo can't be
+// rewritten, or an empty string if they can
+func (c *UpdateRefsCommand) checkLink(resolver *links.Resolver, l links.Link, linkMatches []matcher.Match) string {
+	var ref strings.Builder
+	last := l.RefStart
+	for _, match := range linkMatches {
+		if !l.InRef(match.Start, match.End) {
+			return fmt.Sprintf("'%s' is part of the name or a path of %s/%s, not its ref", match.Text, l.Owner, l.Repo)
+		}
+		ref.WriteString(l.Ref[last-l.RefStart : match.Start-l.RefStart])
+		ref.WriteString(match.Replacement)
+		last = match.End
+	}
+	ref.WriteString(l.Ref[last-l.RefStart:])
+	newRef := ref.String()
+
+	if resolver == nil {
+		return fmt.Sprintf("could not check that branch '%s' exists in %s/%s without a GitHub token", newRef, l.Owner, l.Repo)
+	}
+	exists, err := resolver.BranchExists(l.Owner, l.Repo, newRef)
+	if err != nil {
+		return fmt.Sprintf("could not check that branch '%s' exists: %s", newRef, err)
+	}
+	if !exists {
+		return fmt.Sprintf("branch '%s' does not exist in %s/%s", newRef, l.Owner, l.Repo)
+	}
+
+	return ""
+}
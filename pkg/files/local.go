@@ -0,0 +1,119 @@
+package files
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	git "github.com/go-git/go-git/v5"
+	plumbing "github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/hashicorp/inclusify/pkg/message"
+)
+
+// OpenLocalRepo prepares the existing working tree at $path to be updated in place.
+// Paths ignored by the repo's root .gitignore are added to the exclusions, so that
+// build output and dependencies in a developer's checkout are never rewritten.
+// The repo is only opened with git if the changes will be committed to $localBranch.
+func OpenLocalRepo(c *UpdateRefsCommand) (repoRef *git.Repository, dir string, err error) {
+	dir, err = filepath.Abs(c.Config.Path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to resolve path %s: %w", c.Config.Path, err)
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return nil, "", fmt.Errorf("path %s is not a directory", c.Config.Path)
+	}
+
+	ignored, err := readGitignore(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	c.Config.Exclusion = append(c.Config.Exclusion, ignored...)
+	c.presets, err = ApplyPresets(c.Config, dir)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if c.Config.LocalBranch == "" {
+		c.Config.Logger.Info("Updating references in local dir, changes will be left uncommitted", "dir", dir)
+		return nil, dir, nil
+	}
+
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to open %s as a git repo, it must be the root of the working tree: %w", dir, err)
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get worktree: %w", err)
+	}
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get worktree status: %w", err)
+	}
+	if !status.IsClean() {
+		return nil, "", fmt.Errorf("the working tree at %s has uncommitted changes, commit or stash them before updating references", dir)
+	}
+
+	c.Config.Logger.Info("Updating references in local repo", "dir", dir, "branch", c.Config.LocalBranch)
+
+	return repo, dir, nil
+}
+
+// CommitLocal creates $localBranch at the current HEAD, switches to it without
+// touching the working tree, and commits the changed files to it, with a commit
+// per category of files unless `INCLUSIFY_SINGLE_COMMIT` is set
+func CommitLocal(c *UpdateRefsCommand, repo *git.Repository, result *Result) (err error) {
+	head, err := repo.Head()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve HEAD commit: %w", err)
+	}
+
+	branch := plumbing.NewBranchReferenceName(c.Config.LocalBranch)
+	if _, err := repo.Reference(branch, false); err == nil {
+		return fmt.Errorf("local branch %s already exists", c.Config.LocalBranch)
+	}
+
+	c.Config.Logger.Info("Creating local branch", "branch", c.Config.LocalBranch, "sha", head.Hash())
+	err = repo.Storer.SetReference(plumbing.NewHashReference(branch, head.Hash()))
+	if err != nil {
+		return fmt.Errorf("failed to create local branch %s: %w", c.Config.LocalBranch, err)
+	}
+	err = repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, branch))
+	if err != nil {
+		return fmt.Errorf("failed to switch to local branch %s: %w", c.Config.LocalBranch, err)
+	}
+
+	commits, err := commitChanges(c.Config, repo, result)
+	if err != nil {
+		return err
+	}
+	c.Config.Logger.Info(message.Success("Success! Committed the changes to the local branch"), "branch", c.Config.LocalBranch, "commits", len(commits), "sha", commits[len(commits)-1])
+
+	return nil
+}
+
+// readGitignore returns the patterns in the .gitignore at the root of dir, if any
+func readGitignore(dir string) (patterns []string, err error) {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .gitignore: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			patterns = append(patterns, line)
+		}
+	}
+
+	return patterns, scanner.Err()
+}
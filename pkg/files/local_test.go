@@ -0,0 +1,208 @@
+// +build !integration
+
+package files
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	git "github.com/go-git/go-git/v5"
+	object "github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/inclusify/pkg/config"
+	"github.com/hashicorp/inclusify/pkg/signing"
+)
+
+// initTestRepo creates a git repo with the given files committed to it
+func initTestRepo(t *testing.T, files map[string]string) (*git.Repository, string) {
+	dir := writeTestFiles(t, files, 0644)
+	repo, err := git.PlainInit(dir, false)
+	require.NoError(t, err)
+
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+	_, err = worktree.Add(".")
+	require.NoError(t, err)
+	_, err = worktree.Commit("Initial commit", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	require.NoError(t, err)
+
+	return repo, dir
+}
+
+// Test that changes in a local checkout are left uncommitted, and ignored files are untouched
+func Test_Run_LocalUncommitted(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+	dir := writeTestFiles(t, map[string]string{
+		".gitignore":   "build/\n",
+		"Makefile":     "BRANCH ?= master\n",
+		"build/out.sh": "git push origin master\n",
+	}, 0644)
+	defer os.RemoveAll(dir)
+	c.Config.Path = dir
+
+	require.Equal(t, 0, c.Run([]string{}), ui.ErrorWriter.String())
+
+	read, err := ioutil.ReadFile(filepath.Join(dir, "Makefile"))
+	require.NoError(t, err)
+	assert.Equal(t, "BRANCH ?= main\n", string(read))
+	read, err = ioutil.ReadFile(filepath.Join(dir, "build", "out.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, "git push origin master\n", string(read))
+	assert.Contains(t, ui.OutputWriter.String(), "Success! Review the uncommitted changes in the local dir")
+}
+
+// Test that changes in a local checkout can be committed to a new local branch
+func Test_Run_LocalBranch(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+	repo, dir := initTestRepo(t, map[string]string{
+		"Makefile":                 "BRANCH ?= master\n",
+		"README.md":                "Nothing to see here\n",
+		".github/workflows/ci.yml": "on: {push: {branches: [master]}}\n",
+		"cmd/main.go":              "const branch = \"master\"\n",
+	})
+	defer os.RemoveAll(dir)
+	c.Config.Path = dir
+	c.Config.LocalBranch = "inclusify"
+
+	require.Equal(t, 0, c.Run([]string{}), ui.ErrorWriter.String())
+
+	head, err := repo.Head()
+	require.NoError(t, err)
+	assert.Equal(t, "inclusify", head.Name().Short())
+	// There is a commit per category, each with only the files in that category
+	commit, err := repo.CommitObject(head.Hash())
+	require.NoError(t, err)
+	for _, want := range []struct{ message, path string }{
+		{"Update references from master to main in source code", "cmd/main.go"},
+		{"Update references from master to main in scripts", "Makefile"},
+		{"Update references from master to main in CI configuration", ".github/workflows/ci.yml"},
+	} {
+		assert.Equal(t, want.message, commit.Message)
+		parent, err := commit.Parent(0)
+		require.NoError(t, err)
+		patch, err := parent.Patch(commit)
+		require.NoError(t, err)
+		require.Len(t, patch.FilePatches(), 1)
+		_, to := patch.FilePatches()[0].Files()
+		assert.Equal(t, want.path, to.Path())
+		commit = parent
+	}
+	assert.Equal(t, "Initial commit", commit.Message)
+
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+	status, err := worktree.Status()
+	require.NoError(t, err)
+	assert.True(t, status.IsClean())
+
+	// Running again finds nothing left to update
+	assert.Equal(t, 0, c.Run([]string{}))
+	assert.Contains(t, ui.OutputWriter.String(), "Exiting -- No files contained base")
+}
+
+// Test that a dirty working tree is never committed
+func Test_Run_LocalBranchDirty(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+	_, dir := initTestRepo(t, map[string]string{"Makefile": "BRANCH ?= master\n"})
+	defer os.RemoveAll(dir)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "Makefile"), []byte("BRANCH ?= master # wip\n"), 0644))
+	c.Config.Path = dir
+	c.Config.LocalBranch = "inclusify"
+
+	assert.Equal(t, 1, c.Run([]string{}))
+	assert.Contains(t, ui.OutputWriter.String(), "has uncommitted changes")
+}
+
+// Test that commits have the configured identity and sign-off, and are signed
+func Test_Run_LocalBranchSigned(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+	repo, dir := initTestRepo(t, map[string]string{"Makefile": "BRANCH ?= master\n"})
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPath := filepath.Join(dir, "..", filepath.Base(dir)+".key")
+	require.NoError(t, ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600))
+	defer os.Remove(keyPath)
+
+	c.Config.Path = dir
+	c.Config.LocalBranch = "inclusify"
+	c.Config.Author = config.Identity{Name: "Jane Doe", Email: "jane@example.com"}
+	c.Config.Committer = config.Identity{Name: "Release Bot", Email: "bot@example.com"}
+	c.Config.SignOff = true
+	c.Config.SigningKey = keyPath
+	c.Config.SigningFormat = signing.FormatSSH
+
+	require.Equal(t, 0, c.Run([]string{}), ui.ErrorWriter.String())
+
+	head, err := repo.Head()
+	require.NoError(t, err)
+	commit, err := repo.CommitObject(head.Hash())
+	require.NoError(t, err)
+	assert.Equal(t, "Update references from master to main in scripts\n\nSigned-off-by: Release Bot <bot@example.com>", commit.Message)
+	assert.Equal(t, "Jane Doe", commit.Author.Name)
+	assert.Equal(t, "jane@example.com", commit.Author.Email)
+	assert.Equal(t, "Release Bot", commit.Committer.Name)
+	assert.True(t, strings.HasPrefix(commit.PGPSignature, "-----BEGIN SSH SIGNATURE-----\n"), commit.PGPSignature)
+
+	// The signed commit replaced the unsigned one, which is no longer on the branch
+	parent, err := commit.Parent(0)
+	require.NoError(t, err)
+	assert.Equal(t, "Initial commit", parent.Message)
+}
+
+// Test that commits are signed by go-git with GPG keys
+func Test_Run_LocalBranchSignedGPG(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+	repo, dir := initTestRepo(t, map[string]string{"Makefile": "BRANCH ?= master\n"})
+	defer os.RemoveAll(dir)
+
+	entity, err := openpgp.NewEntity("Release Bot", "", "bot@example.com", nil)
+	require.NoError(t, err)
+	var key, public bytes.Buffer
+	require.NoError(t, entity.SerializePrivate(&key, nil))
+	keyPath := filepath.Join(dir, "..", filepath.Base(dir)+".gpg")
+	require.NoError(t, ioutil.WriteFile(keyPath, key.Bytes(), 0600))
+	defer os.Remove(keyPath)
+	w, err := armor.Encode(&public, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+
+	c.Config.Path = dir
+	c.Config.LocalBranch = "inclusify"
+	c.Config.SigningKey = keyPath
+	c.Config.SigningFormat = signing.FormatOpenPGP
+
+	require.Equal(t, 0, c.Run([]string{}), ui.ErrorWriter.String())
+
+	head, err := repo.Head()
+	require.NoError(t, err)
+	commit, err := repo.CommitObject(head.Hash())
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(commit.PGPSignature, "-----BEGIN PGP SIGNATURE-----"), commit.PGPSignature)
+	signedBy, err := commit.Verify(public.String())
+	require.NoError(t, err)
+	assert.Equal(t, entity.PrimaryKey.KeyId, signedBy.PrimaryKey.KeyId)
+}
@@ -0,0 +1,33 @@
+package files
+
+import (
+	"strings"
+
+	"github.com/hashicorp/inclusify/pkg/config"
+	"github.com/hashicorp/inclusify/pkg/presets"
+)
+
+// ApplyPresets adds the exclusions of the presets in `INCLUSIFY_PRESETS` before
+// the other exclusions, so that a path can be re-included with a '!' pattern. The
+// presets are detected from the marker files in the repo at dir if they include
+// 'auto'. It returns the names of the presets that were applied.
+func ApplyPresets(c *config.Config, dir string) (applied []string, err error) {
+	resolved, err := presets.Resolve(c.Presets, dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(resolved) == 0 {
+		c.Logger.Info("No exclusion presets apply to the repo", "presets", strings.Join(c.Presets, ","))
+		return nil, nil
+	}
+
+	var exclusion []string
+	for _, p := range resolved {
+		applied = append(applied, p.Name)
+		exclusion = append(exclusion, p.Exclusion...)
+		c.Logger.Info("Applied exclusion preset", "preset", p.Name, "exclusion", strings.Join(p.Exclusion, ","))
+	}
+	c.Exclusion = append(exclusion, c.Exclusion...)
+
+	return applied, nil
+}
@@ -0,0 +1,327 @@
+package files
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/inclusify/pkg/config"
+	"github.com/hashicorp/inclusify/pkg/presets"
+	"github.com/hashicorp/inclusify/pkg/version"
+)
+
+// SummaryMarker starts the HTML comment at the end of the PR body that holds
+// the PullSummary as JSON, e.g. '<!-- inclusify:summary {...} -->'
+const SummaryMarker = "inclusify:summary"
+
+// collapseRows is how many rows a table can have before it's collapsed into a
+// <details> section, and maxRows is how many are listed at most. GitHub limits
+// PR bodies to maxBodyLength characters, so fewer rows are listed if the body
+// would be longer.
+const (
+	collapseRows  = 10
+	maxRows       = 250
+	maxBodyLength = 65536
+)
+
+// truncatedNote replaces the end of the Markdown when the body is still too
+// long for GitHub without listing any rows, e.g. because of a long scope
+const truncatedNote = "\n…\n\n**NOTE**: This summary was cut short to fit in the PR. This PR was generated automatically. Please take a close look before approving and merging!\n"
+
+// PullSummary is the machine-readable summary of the changes in a PR
+type PullSummary struct {
+	Version      string        `json:"version"`
+	Base         string        `json:"base"`
+	Target       string        `json:"target"`
+	Replacements int           `json:"replacements"`
+	FilesChanged int           `json:"files_changed"`
+	SkippedFiles int           `json:"skipped_files,omitempty"`
+	TermsCount   int           `json:"terms_count"`
+	// Terms, Files and Skipped list the replaced terms and the changed and
+	// skipped files, up to maxRows of each. Truncated is true if any has more.
+	Terms     []TermSummary `json:"terms"`
+	Files     []FileSummary `json:"files"`
+	Skipped   []SkippedFile `json:"skipped,omitempty"`
+	Truncated bool          `json:"truncated,omitempty"`
+	Flagged   int           `json:"flagged_links,omitempty"`
+	Exclusion []string      `json:"exclusion,omitempty"`
+	Presets   []string      `json:"presets,omitempty"`
+	Include   []string      `json:"include,omitempty"`
+}
+
+// TermSummary is how many times a term was replaced, and in how many files
+type TermSummary struct {
+	Term         string `json:"term"`
+	Replacement  string `json:"replacement"`
+	Replacements int    `json:"replacements"`
+	Files        int    `json:"files"`
+}
+
+// FileSummary is how many replacements were made in a changed file
+type FileSummary struct {
+	Path         string `json:"path"`
+	Category     string `json:"category"`
+	Replacements int    `json:"replacements"`
+}
+
+// Summarize returns the summary of the changes in result
+func (c *UpdateRefsCommand) Summarize(result *Result) *PullSummary {
+	return c.summarize(result, maxRows)
+}
+
+// summarize returns the summary of the changes in result, listing up to rows
+// terms, changed files and skipped files
+func (c *UpdateRefsCommand) summarize(result *Result, rows int) *PullSummary {
+	summary := &PullSummary{
+		Version:      version.Version,
+		Base:         c.Config.Base,
+		Target:       c.Config.Target,
+		Replacements: result.Replacements(),
+		FilesChanged: len(result.Changed),
+		SkippedFiles: len(result.Skipped),
+		Flagged:      len(result.Flagged),
+		Exclusion:    userExclusion(c.Config, c.presets),
+		Presets:      c.presets,
+		Include:      c.Config.Include,
+	}
+
+	terms := map[string]*TermSummary{}
+	for _, change := range result.Changed {
+		if len(summary.Files) < rows {
+			summary.Files = append(summary.Files, FileSummary{Path: change.Path, Category: Categorize(change.Path), Replacements: len(change.Matches)})
+		} else {
+			summary.Truncated = true
+		}
+
+		inFile := map[string]bool{}
+		for _, match := range change.Matches {
+			key := match.Term.From + "\x00" + match.Term.To
+			term, ok := terms[key]
+			if !ok {
+				term = &TermSummary{Term: match.Term.From, Replacement: match.Term.To}
+				terms[key] = term
+			}
+			term.Replacements++
+			if !inFile[key] {
+				inFile[key] = true
+				term.Files++
+			}
+		}
+	}
+	summary.Skipped = result.Skipped
+	if len(summary.Skipped) > rows {
+		summary.Skipped = summary.Skipped[:rows]
+		summary.Truncated = true
+	}
+
+	for _, term := range terms {
+		summary.Terms = append(summary.Terms, *term)
+	}
+	sort.Slice(summary.Terms, func(i, j int) bool {
+		if summary.Terms[i].Replacements != summary.Terms[j].Replacements {
+			return summary.Terms[i].Replacements > summary.Terms[j].Replacements
+		}
+		return summary.Terms[i].Term < summary.Terms[j].Term
+	})
+	summary.TermsCount = len(summary.Terms)
+	if len(summary.Terms) > rows {
+		summary.Terms = summary.Terms[:rows]
+		summary.Truncated = true
+	}
+
+	return summary
+}
+
+// userExclusion returns the exclusions from `INCLUSIFY_EXCLUSION`, without the
+// default ones and those of the applied presets
+func userExclusion(c *config.Config, applied []string) (exclusion []string) {
+	hidden := map[string]bool{}
+	for _, pattern := range config.DefaultExclusion {
+		hidden[pattern] = true
+	}
+	for _, name := range applied {
+		if p, err := presets.Lookup(name); err == nil {
+			for _, pattern := range p.Exclusion {
+				hidden[pattern] = true
+			}
+		}
+	}
+
+	for _, pattern := range c.Exclusion {
+		if !hidden[pattern] {
+			exclusion = append(exclusion, pattern)
+		}
+	}
+	return exclusion
+}
+
+// pullBody returns the Markdown body of the PR, which ends with the summary as
+// JSON in an HTML comment. Fewer rows are listed if the body would be too long
+// for GitHub, and if that's still not enough, the end of the Markdown is cut.
+func (c *UpdateRefsCommand) pullBody(result *Result) (body string, err error) {
+	var text, comment string
+	for rows := maxRows; ; rows /= 2 {
+		text, comment, err = c.renderBody(result, rows)
+		if err != nil {
+			return "", err
+		}
+		if len(text)+len(comment) <= maxBodyLength {
+			return text + comment, nil
+		}
+		if rows == 0 {
+			break
+		}
+	}
+
+	keep := maxBodyLength - len(truncatedNote) - len(comment)
+	if keep < 0 {
+		return "", fmt.Errorf("the PR summary is %d characters long, over GitHub's limit of %d", len(comment), maxBodyLength)
+	}
+	// Cut at a line break, so that no character or table row is split
+	text = text[:strings.LastIndex(text[:keep], "\n")+1]
+	return text + truncatedNote + comment, nil
+}
+
+// renderBody returns the Markdown of the PR body, with up to rows rows in each
+// table, and the HTML comment with the summary that goes after it
+func (c *UpdateRefsCommand) renderBody(result *Result, rows int) (text, comment string, err error) {
+	summary := c.summarize(result, rows)
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "This PR updates references from `%s` to `%s` in this repo: **%d replacement(s) in %d file(s)**.\n", summary.Base, summary.Target, summary.Replacements, summary.FilesChanged)
+
+	b.WriteString("\n### Terms\n\n| Term | Replacement | Replacements | Files |\n| --- | --- | ---: | ---: |\n")
+	for _, term := range summary.Terms {
+		fmt.Fprintf(&b, "| %s | %s | %d | %d |\n", code(term.Term), code(term.Replacement), term.Replacements, term.Files)
+	}
+	if more := summary.TermsCount - len(summary.Terms); more > 0 {
+		fmt.Fprintf(&b, "| … and %d more | | | |\n", more)
+	}
+
+	var lines []string
+	for _, file := range summary.Files {
+		lines = append(lines, fmt.Sprintf("| %s | %s | %d |", code(file.Path), categoryTitles[file.Category], file.Replacements))
+	}
+	if more := summary.FilesChanged - len(summary.Files); more > 0 {
+		lines = append(lines, fmt.Sprintf("| … and %d more | | |", more))
+	}
+	writeTable(&b, fmt.Sprintf("Changed files (%d)", summary.FilesChanged), "| File | Category | Replacements |\n| --- | --- | ---: |", lines)
+	if !c.Config.SingleCommit {
+		b.WriteString("\nThe changes are split into a commit per category, so that each can be reviewed and reverted on its own.\n")
+	}
+
+	if summary.SkippedFiles > 0 {
+		lines = nil
+		for _, skipped := range summary.Skipped {
+			lines = append(lines, fmt.Sprintf("| %s | %s |", code(skipped.Path), skipped.Reason))
+		}
+		if more := summary.SkippedFiles - len(summary.Skipped); more > 0 {
+			lines = append(lines, fmt.Sprintf("| … and %d more | |", more))
+		}
+		b.WriteString("\nThese files were skipped because they cannot be safely updated, please check them manually.\n")
+		writeTable(&b, fmt.Sprintf("Skipped files (%d)", summary.SkippedFiles), "| File | Reason |\n| --- | --- |", lines)
+	}
+
+	if len(result.Flagged) > 0 {
+		lines = nil
+		for i, flagged := range result.Flagged {
+			if i == rows {
+				lines = append(lines, fmt.Sprintf("| … and %d more | | | |", len(result.Flagged)-rows))
+				break
+			}
+			lines = append(lines, fmt.Sprintf("| %s | %d | %s | %s |", code(flagged.Path), flagged.Line, cell(flagged.URL), cell(flagged.Reason)))
+		}
+		b.WriteString("\nThese references to other repos were not updated, because the new branch could not be verified. Please check them manually.\n")
+		writeTable(&b, fmt.Sprintf("Links to review (%d)", len(result.Flagged)), "| File | Line | Link | Reason |\n| --- | ---: | --- | --- |", lines)
+	}
+
+	if len(summary.Exclusion) > 0 || len(summary.Presets) > 0 || len(summary.Include) > 0 {
+		b.WriteString("\n### Scope\n\n")
+		if len(summary.Exclusion) > 0 {
+			fmt.Fprintf(&b, "- Excluded paths: %s\n", codeList(summary.Exclusion))
+		}
+		if len(summary.Presets) > 0 {
+			fmt.Fprintf(&b, "- Exclusion presets: %s\n", codeList(summary.Presets))
+		}
+		if len(summary.Include) > 0 {
+			fmt.Fprintf(&b, "- Only these paths were updated: %s\n", codeList(summary.Include))
+		}
+	}
+
+	var pulls, failed []string
+	for _, sub := range c.submodules {
+		if sub.Err != nil {
+			failed = append(failed, fmt.Sprintf("- %s/%s: %s", sub.Owner, sub.Repo, cell(sub.Err.Error())))
+		} else if sub.Pull != nil {
+			pulls = append(pulls, fmt.Sprintf("- %s/%s: %s", sub.Owner, sub.Repo, sub.Pull.GetHTMLURL()))
+		}
+	}
+	if len(pulls) > 0 || len(failed) > 0 {
+		b.WriteString("\n### Submodules\n")
+	}
+	if len(pulls) > 0 {
+		b.WriteString("\nReferences were also updated in these submodules, which should be merged first:\n\n" + strings.Join(pulls, "\n") + "\n")
+	}
+	if len(failed) > 0 {
+		b.WriteString("\nThese submodules could not be migrated, so their references must be updated manually:\n\n" + strings.Join(failed, "\n") + "\n")
+	}
+
+	b.WriteString("\n**NOTE**: This PR was generated automatically. Please take a close look before approving and merging!\n")
+
+	// encoding/json escapes '<' and '>', so the JSON can never close the comment early
+	encoded, err := json.Marshal(summary)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode the PR summary: %w", err)
+	}
+
+	return b.String(), fmt.Sprintf("\n<!-- %s\n%s\n-->\n", SummaryMarker, encoded), nil
+}
+
+// ParseSummary returns the summary embedded in the body of a PR opened by
+// updateRefs, or nil if there is none
+func ParseSummary(body string) (summary *PullSummary, err error) {
+	start := strings.Index(body, "<!-- "+SummaryMarker)
+	if start < 0 {
+		return nil, nil
+	}
+	rest := body[start+len("<!-- "+SummaryMarker):]
+	end := strings.Index(rest, "-->")
+	if end < 0 {
+		return nil, fmt.Errorf("the PR summary is not terminated")
+	}
+
+	summary = &PullSummary{}
+	if err := json.Unmarshal([]byte(rest[:end]), summary); err != nil {
+		return nil, fmt.Errorf("failed to decode the PR summary: %w", err)
+	}
+	return summary, nil
+}
+
+// writeTable writes a table under a heading, or in a collapsed <details>
+// section if it has many rows
+func writeTable(b *strings.Builder, title, header string, rows []string) {
+	if len(rows) > collapseRows {
+		fmt.Fprintf(b, "\n<details>\n<summary>%s</summary>\n\n%s\n%s\n\n</details>\n", title, header, strings.Join(rows, "\n"))
+		return
+	}
+	fmt.Fprintf(b, "\n### %s\n\n%s\n%s\n", title, header, strings.Join(rows, "\n"))
+}
+
+// cell escapes s for a Markdown table cell
+func cell(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// code formats s as inline code in a Markdown table cell
+func code(s string) string {
+	return "`" + cell(strings.ReplaceAll(s, "`", "'")) + "`"
+}
+
+func codeList(list []string) string {
+	formatted := make([]string, len(list))
+	for i, s := range list {
+		formatted[i] = code(s)
+	}
+	return strings.Join(formatted, ", ")
+}
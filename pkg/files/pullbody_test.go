@@ -0,0 +1,199 @@
+// +build !integration
+
+package files
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/inclusify/pkg/matcher"
+)
+
+func testMatches(from, to string, n int) (matches []matcher.Match) {
+	for i := 0; i < n; i++ {
+		matches = append(matches, matcher.Match{Term: matcher.Term{From: from, To: to}})
+	}
+	return matches
+}
+
+// Test that the PR body summarizes the changes per term and file, and hides the default exclusions
+func Test_PullBody(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+	c.Config.Exclusion = append(c.Config.Exclusion, "vendor/", "docs|old/")
+	c.Config.SingleCommit = true
+	c.presets = []string{"go"}
+
+	result := &Result{
+		Changed: []FileChange{
+			{Path: "README.md", Matches: append(testMatches("master", "main", 2), testMatches("whitelist", "allowlist", 1)...)},
+			{Path: "main.go", Matches: testMatches("master", "main", 1)},
+		},
+		Skipped: []SkippedFile{{Path: "logo.png", Reason: "binary"}},
+	}
+
+	body, err := c.pullBody(result)
+	require.NoError(t, err)
+
+	assert.Contains(t, body, "**4 replacement(s) in 2 file(s)**")
+	assert.Contains(t, body, "| `master` | `main` | 3 | 2 |")
+	assert.Contains(t, body, "| `whitelist` | `allowlist` | 1 | 1 |")
+	assert.Contains(t, body, "| `README.md` | documentation | 3 |")
+	assert.Contains(t, body, "| `logo.png` | binary |")
+	assert.Contains(t, body, "- Excluded paths: `docs\\|old/`\n")
+	assert.Contains(t, body, "- Exclusion presets: `go`\n")
+	assert.NotContains(t, body, ".git/")
+	assert.NotContains(t, body, "<details>")
+
+	summary, err := ParseSummary(body)
+	require.NoError(t, err)
+	require.NotNil(t, summary)
+	assert.Equal(t, 4, summary.Replacements)
+	assert.Equal(t, []string{"docs|old/"}, summary.Exclusion)
+	assert.Equal(t, []TermSummary{
+		{Term: "master", Replacement: "main", Replacements: 3, Files: 2},
+		{Term: "whitelist", Replacement: "allowlist", Replacements: 1, Files: 1},
+	}, summary.Terms)
+	assert.Len(t, summary.Files, 2)
+}
+
+// Test that the PR body lists the submodule PRs, and the submodules that failed to migrate
+func Test_PullBody_Submodules(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+	c.submodules = []submodulePull{
+		{Owner: "hashicorp", Repo: "lib", Pull: &github.PullRequest{HTMLURL: github.String("https://github.com/hashicorp/lib/pull/1")}},
+		{Owner: "hashicorp", Repo: "docs", Err: fmt.Errorf("failed to create branches in hashicorp/docs")},
+	}
+
+	body, err := c.pullBody(&Result{Changed: []FileChange{{Path: ".gitmodules", Matches: testMatches("master", "main", 1)}}})
+	require.NoError(t, err)
+	assert.Contains(t, body, "which should be merged first:\n\n- hashicorp/lib: https://github.com/hashicorp/lib/pull/1\n")
+	assert.Contains(t, body, "must be updated manually:\n\n- hashicorp/docs: failed to create branches in hashicorp/docs\n")
+}
+
+// Test that long tables are collapsed and truncated
+func Test_PullBody_Large(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+
+	result := &Result{}
+	for i := 0; i < maxRows+5; i++ {
+		result.Changed = append(result.Changed, FileChange{Path: fmt.Sprintf("docs/%d.md", i), Matches: testMatches("master", "main", 1)})
+	}
+
+	body, err := c.pullBody(result)
+	require.NoError(t, err)
+	assert.Contains(t, body, fmt.Sprintf("<details>\n<summary>Changed files (%d)</summary>", maxRows+5))
+	assert.Contains(t, body, "| … and 5 more | | |")
+	assert.Equal(t, maxRows, strings.Count(body, "| documentation | 1 |"))
+
+	summary, err := ParseSummary(body)
+	require.NoError(t, err)
+	assert.True(t, summary.Truncated)
+	assert.Len(t, summary.Files, maxRows)
+	assert.Equal(t, maxRows+5, summary.FilesChanged)
+}
+
+// Test that the skipped files are truncated in both the table and the summary
+func Test_PullBody_LargeSkipped(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+
+	result := &Result{Changed: []FileChange{{Path: "README.md", Matches: testMatches("master", "main", 1)}}}
+	for i := 0; i < maxRows+5; i++ {
+		result.Skipped = append(result.Skipped, SkippedFile{Path: fmt.Sprintf("vendor/%d.bin", i), Reason: "binary"})
+	}
+
+	body, err := c.pullBody(result)
+	require.NoError(t, err)
+	assert.Contains(t, body, fmt.Sprintf("<details>\n<summary>Skipped files (%d)</summary>", maxRows+5))
+	assert.Contains(t, body, "| … and 5 more | |")
+
+	summary, err := ParseSummary(body)
+	require.NoError(t, err)
+	assert.True(t, summary.Truncated)
+	assert.Len(t, summary.Skipped, maxRows)
+	assert.Equal(t, maxRows+5, summary.SkippedFiles)
+}
+
+// Test that the body never exceeds GitHub's limit, by listing fewer rows and
+// then cutting the Markdown, and fails if the summary alone is too long
+func Test_PullBody_MaxLength(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+
+	long := strings.Repeat("a", 200)
+	result := &Result{}
+	for i := 0; i < maxRows; i++ {
+		result.Changed = append(result.Changed, FileChange{Path: fmt.Sprintf("docs/%s/%d.md", long, i), Matches: testMatches("master", "main", 1)})
+		result.Skipped = append(result.Skipped, SkippedFile{Path: fmt.Sprintf("vendor/%s/%d.bin", long, i), Reason: "binary"})
+	}
+
+	body, err := c.pullBody(result)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(body), maxBodyLength)
+
+	summary, err := ParseSummary(body)
+	require.NoError(t, err)
+	assert.True(t, summary.Truncated)
+	assert.Less(t, len(summary.Files), maxRows)
+	assert.Equal(t, maxRows, summary.FilesChanged)
+	assert.Equal(t, maxRows, summary.SkippedFiles)
+
+	// Terms and flagged links are listed in fewer rows too
+	result = &Result{}
+	for i := 0; i < 1000; i++ {
+		term := fmt.Sprintf("%s-%d", long, i)
+		result.Changed = append(result.Changed, FileChange{Path: fmt.Sprintf("%d.md", i), Matches: testMatches(term, "main", 1)})
+		result.Flagged = append(result.Flagged, FlaggedLink{Path: fmt.Sprintf("%d.md", i), Line: 1, URL: "https://github.com/other/" + term, Reason: "branch 'main' does not exist"})
+	}
+
+	body, err = c.pullBody(result)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(body), maxBodyLength)
+	assert.Contains(t, body, "more | | | |")
+
+	summary, err = ParseSummary(body)
+	require.NoError(t, err)
+	assert.True(t, summary.Truncated)
+	assert.Less(t, len(summary.Terms), maxRows)
+	assert.Equal(t, 1000, summary.TermsCount)
+	assert.Equal(t, 1000, summary.Flagged)
+
+	// The Markdown is cut if it's still too long without any rows
+	for i := 0; len(strings.Join(c.Config.Exclusion, ",")) < maxBodyLength/2; i++ {
+		c.Config.Exclusion = append(c.Config.Exclusion, fmt.Sprintf("%s/%d/", long, i))
+	}
+
+	body, err = c.pullBody(result)
+	require.NoError(t, err)
+	assert.LessOrEqual(t, len(body), maxBodyLength)
+	assert.Contains(t, body, truncatedNote)
+
+	summary, err = ParseSummary(body)
+	require.NoError(t, err)
+	assert.Empty(t, summary.Terms)
+	assert.Len(t, summary.Exclusion, len(c.Config.Exclusion)-1)
+
+	// And the summary itself can't be cut
+	c.Config.Exclusion = append(c.Config.Exclusion, c.Config.Exclusion...)
+	_, err = c.pullBody(result)
+	assert.Error(t, err)
+}
+
+// Test that bodies without a summary are ignored, and malformed ones are rejected
+func Test_ParseSummary(t *testing.T) {
+	summary, err := ParseSummary("An unrelated PR")
+	assert.NoError(t, err)
+	assert.Nil(t, summary)
+
+	_, err = ParseSummary("<!-- inclusify:summary\n{")
+	assert.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package files
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hashicorp/inclusify/pkg/matcher"
+	"github.com/hashicorp/inclusify/pkg/message"
+)
+
+// reviewContext is the number of unchanged lines shown around each proposed change
+const reviewContext = 2
+
+const reviewHelp = `y - apply this change
+n - do not apply this change
+e - edit the replacement for this change
+a - apply this change and all remaining changes in this file
+q - quit; do not apply this change or any remaining changes
+? - print help`
+
+// Review shows each change made by UpdateReferences through the UI, and asks the
+// operator whether to apply it. Rejected changes are reverted in the files on
+// disk, and the returned result only contains the changes that were accepted.
+func Review(c *UpdateRefsCommand, dir string, result *Result) (reviewed *Result, err error) {
+	reviewed = &Result{Skipped: result.Skipped}
+	total := result.Replacements()
+	count := 0
+	quit := false
+
+	for _, change := range result.Changed {
+		text, enc, err := decodeText(change.original)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s: %w", change.Path, err)
+		}
+
+		var accepted []matcher.Match
+		acceptAll := false
+		for _, match := range change.Matches {
+			count++
+			if quit {
+				continue
+			}
+			if acceptAll {
+				accepted = append(accepted, match)
+				continue
+			}
+
+			c.UI.Output(reviewHunk(change.Path, text, match, count, total))
+			answer, err := c.askReview(match)
+			if err != nil {
+				return nil, err
+			}
+			switch answer {
+			case "y":
+				accepted = append(accepted, match)
+			case "a":
+				acceptAll = true
+				accepted = append(accepted, match)
+			case "e":
+				replacement, err := c.UI.Ask(fmt.Sprintf("Replace '%s' with (leave empty for '%s'):", match.Text, match.Replacement))
+				if err != nil {
+					return nil, fmt.Errorf("failed to read the replacement: %w", err)
+				}
+				if replacement != "" {
+					match.Replacement = replacement
+				}
+				accepted = append(accepted, match)
+			case "q":
+				quit = true
+			}
+		}
+
+		updated := change.original
+		if len(accepted) > 0 {
+			updated = encodeText(matcher.Apply(text, accepted), enc)
+			reviewed.Changed = append(reviewed.Changed, FileChange{Path: change.Path, Matches: accepted, original: change.original, updated: updated})
+		}
+		if c.Config.DryRun || bytes.Equal(updated, change.updated) {
+			continue
+		}
+
+		// Write the reviewed contents over what UpdateReferences wrote
+		path := filepath.Join(dir, filepath.FromSlash(change.Path))
+		fi, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		err = writeFile(path, updated, fi.Mode())
+		if err != nil {
+			return nil, fmt.Errorf("failed to update file %s: %w", change.Path, err)
+		}
+	}
+
+	c.Config.Logger.Info("Finished reviewing changes", "accepted", reviewed.Replacements(), "rejected", total-reviewed.Replacements())
+
+	return reviewed, nil
+}
+
+// askReview asks whether to apply a change until it gets a valid answer
+func (c *UpdateRefsCommand) askReview(match matcher.Match) (answer string, err error) {
+	for {
+		answer, err = c.UI.Ask(fmt.Sprintf("Replace '%s' with '%s' [y,n,e,a,q,?]?", match.Text, match.Replacement))
+		if err != nil {
+			return "", fmt.Errorf("failed to read the answer: %w", err)
+		}
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		switch answer {
+		case "y", "n", "e", "a", "q":
+			return answer, nil
+		}
+		c.UI.Output(reviewHelp)
+	}
+}
+
+// reviewHunk returns the line containing the match before and after it is
+// replaced, surrounded by a few lines of context, e.g.
+//
+//	scripts/release.sh:2:17 (1/3)
+//	   1 | #!/bin/sh
+//	-  2 | git push origin master
+//	+  2 | git push origin main
+//	   3 | echo done
+func reviewHunk(path string, text []byte, match matcher.Match, n, total int) string {
+	var b strings.Builder
+	b.WriteString(message.Info(fmt.Sprintf("%s:%d:%d (%d/%d)", path, match.Line, match.Column, n, total)))
+	b.WriteString("\n")
+
+	lines := strings.Split(strings.TrimSuffix(string(text), "\n"), "\n")
+	idx := match.Line - 1
+	lineStart := bytes.LastIndexByte(text[:match.Start], '\n') + 1
+	line := strings.TrimRight(lines[idx], "\r")
+	replaced := line[:match.Start-lineStart] + match.Replacement + line[match.End-lineStart:]
+
+	for i := max(0, idx-reviewContext); i < idx; i++ {
+		fmt.Fprintf(&b, "  %4d | %s\n", i+1, strings.TrimRight(lines[i], "\r"))
+	}
+	b.WriteString(message.Error(fmt.Sprintf("- %4d | %s", match.Line, line)) + "\n")
+	b.WriteString(message.Success(fmt.Sprintf("+ %4d | %s", match.Line, replaced)) + "\n")
+	for i := idx + 1; i < min(len(lines), idx+1+reviewContext); i++ {
+		fmt.Fprintf(&b, "  %4d | %s\n", i+1, strings.TrimRight(lines[i], "\r"))
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,73 @@
+// +build !integration
+
+package files
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that only accepted and edited changes are kept, and that rejected ones are reverted
+func Test_Review(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+	c.UI = ui
+	dir := writeTestFiles(t, map[string]string{
+		"a.sh": "git push origin master\ngit pull origin master\n# master key\n",
+		"b.sh": "git checkout master\necho master\n",
+		"c.sh": "BRANCH=master\n",
+	}, 0644)
+	defer os.RemoveAll(dir)
+
+	result, err := UpdateReferences(c, dir)
+	require.NoError(t, err)
+	require.Equal(t, 6, result.Replacements())
+
+	// a.sh: accept, reject after an invalid answer, edit. b.sh: accept all. c.sh: quit
+	// MockUi buffers its input on every call, so feed it one byte at a time
+	ui.InputReader = iotest.OneByteReader(strings.NewReader("y\nx\nn\ne\nprimary\na\nq\n"))
+	reviewed, err := Review(c, dir, result)
+	require.NoError(t, err)
+	assert.Equal(t, 4, reviewed.Replacements())
+	assert.Len(t, reviewed.Changed, 2)
+
+	want := map[string]string{
+		"a.sh": "git push origin main\ngit pull origin master\n# primary key\n",
+		"b.sh": "git checkout main\necho main\n",
+		"c.sh": "BRANCH=master\n",
+	}
+	for name, content := range want {
+		read, err := ioutil.ReadFile(filepath.Join(dir, name))
+		require.NoError(t, err)
+		assert.Equal(t, content, string(read), name)
+	}
+	assert.Contains(t, ui.OutputWriter.String(), "a - apply this change and all remaining changes in this file")
+}
+
+// Test that each change is shown with its surrounding lines
+func Test_ReviewHunk(t *testing.T) {
+	text := []byte("one\ntwo\nthree master\r\nfour\nfive\nsix\n")
+	m, err := NewMatcher(newTestUpdateRefsCommand(cli.NewMockUi()).Config)
+	require.NoError(t, err)
+	matches := m.Find(text)
+	require.Len(t, matches, 1)
+
+	want := []string{
+		"f.txt:3:7 (1/2)",
+		"     1 | one",
+		"     2 | two",
+		"-    3 | three master",
+		"+    3 | three main",
+		"     4 | four",
+		"     5 | five",
+	}
+	assert.Equal(t, strings.Join(want, "\n"), reviewHunk("f.txt", text, matches[0], 1, 2))
+}
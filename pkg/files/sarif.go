@@ -0,0 +1,166 @@
+package files
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/inclusify/pkg/version"
+)
+
+// The SARIF 2.1.0 schema, see https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// sarifLog is the subset of a SARIF log that inclusify reports
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool     `json:"tool"`
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     sarifMessage       `json:"shortDescription"`
+	Help                 sarifMessage       `json:"help"`
+	DefaultConfiguration sarifConfiguration `json:"defaultConfiguration"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	RuleIndex int             `json:"ruleIndex"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+	Fixes     []sarifFix      `json:"fixes"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId"`
+}
+
+type sarifRegion struct {
+	StartLine   int           `json:"startLine"`
+	StartColumn int           `json:"startColumn"`
+	EndLine     int           `json:"endLine"`
+	EndColumn   int           `json:"endColumn"`
+	Snippet     *sarifMessage `json:"snippet,omitempty"`
+}
+
+type sarifFix struct {
+	Description     sarifMessage          `json:"description"`
+	ArtifactChanges []sarifArtifactChange `json:"artifactChanges"`
+}
+
+type sarifArtifactChange struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Replacements     []sarifReplacement    `json:"replacements"`
+}
+
+type sarifReplacement struct {
+	DeletedRegion   sarifRegion  `json:"deletedRegion"`
+	InsertedContent sarifMessage `json:"insertedContent"`
+}
+
+// sarif converts the report to a SARIF 2.1.0 log, with one rule per dictionary
+// term. Every finding has its exact region, and a fix that replaces it.
+// Columns are counted in characters, rather than SARIF's default of UTF-16 code units.
+func (r *ScanReport) sarif() *sarifLog {
+	driver := sarifDriver{
+		Name:           "inclusify",
+		Version:        version.Version,
+		InformationURI: "https://github.com/hashicorp/inclusify",
+		Rules:          []sarifRule{},
+	}
+	ruleIndex := map[string]int{}
+	for _, e := range r.rules {
+		id := e.RuleID()
+		if _, ok := ruleIndex[id]; ok {
+			continue
+		}
+		ruleIndex[id] = len(driver.Rules)
+		driver.Rules = append(driver.Rules, sarifRule{
+			ID:                   id,
+			ShortDescription:     sarifMessage{Text: e.RuleDescription()},
+			Help:                 sarifMessage{Text: fmt.Sprintf("Replace '%s' with '%s'.", e.Term, e.Replacement)},
+			DefaultConfiguration: sarifConfiguration{Level: e.RuleSeverity()},
+		})
+	}
+
+	results := []sarifResult{}
+	for _, f := range r.Findings {
+		artifact := sarifArtifactLocation{URI: f.Path, URIBaseID: "%SRCROOT%"}
+		region := sarifRegion{StartLine: f.Line, StartColumn: f.Column, EndLine: f.Line, EndColumn: f.EndColumn}
+		results = append(results, sarifResult{
+			RuleID:    f.Rule,
+			RuleIndex: ruleIndex[f.Rule],
+			Level:     f.Severity,
+			Message:   sarifMessage{Text: fmt.Sprintf("'%s' should be replaced with '%s'", f.Match, f.Replacement)},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: artifact,
+				Region: sarifRegion{
+					StartLine:   region.StartLine,
+					StartColumn: region.StartColumn,
+					EndLine:     region.EndLine,
+					EndColumn:   region.EndColumn,
+					Snippet:     &sarifMessage{Text: f.Match},
+				},
+			}}},
+			Fixes: []sarifFix{{
+				Description: sarifMessage{Text: fmt.Sprintf("Replace '%s' with '%s'", f.Match, f.Replacement)},
+				ArtifactChanges: []sarifArtifactChange{{
+					ArtifactLocation: artifact,
+					Replacements: []sarifReplacement{{
+						DeletedRegion:   region,
+						InsertedContent: sarifMessage{Text: f.Replacement},
+					}},
+				}},
+			}},
+		})
+	}
+
+	return &sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool:       sarifTool{Driver: driver},
+			ColumnKind: "unicodeCodePoints",
+			Results:    results,
+		}},
+	}
+}
@@ -0,0 +1,267 @@
+package files
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mitchellh/cli"
+
+	"github.com/hashicorp/inclusify/pkg/config"
+	"github.com/hashicorp/inclusify/pkg/matcher"
+	"github.com/hashicorp/inclusify/pkg/message"
+	"github.com/hashicorp/inclusify/pkg/terms"
+)
+
+// Formats of the scan report
+const (
+	FormatText  = "text"
+	FormatJSON  = "json"
+	FormatCSV   = "csv"
+	FormatSARIF = "sarif"
+)
+
+// ScanCommand is a struct used to configure a Command for reporting
+// references without modifying anything
+type ScanCommand struct {
+	Config *config.Config
+	UI     cli.Ui
+}
+
+// Finding is a single reference found by Scan. Line and Column are 1-based,
+// and Column is counted in characters. EndColumn is the column just after the match.
+type Finding struct {
+	Path        string `json:"path"`
+	Line        int    `json:"line"`
+	Column      int    `json:"column"`
+	EndColumn   int    `json:"endColumn"`
+	Term        string `json:"term"`
+	Match       string `json:"match"`
+	Replacement string `json:"replacement"`
+	Rule        string `json:"rule"`
+	Severity    string `json:"severity"`
+}
+
+// ScanReport lists every reference in a repo, and the files that were skipped
+type ScanReport struct {
+	FilesScanned int           `json:"filesScanned"`
+	Findings     []Finding     `json:"findings"`
+	Skipped      []SkippedFile `json:"skipped"`
+	Presets      []string      `json:"presets"`
+
+	// rules are the dictionary entries that were scanned for
+	rules []terms.Entry
+}
+
+// fileScan is the outcome of scanning a single file
+type fileScan struct {
+	size    int64
+	skip    string
+	matches []matcher.Match
+}
+
+// Scan walks through the files in dir and reports every reference that
+// UpdateReferences would replace, using the same exclusions and skip rules.
+// Nothing is written.
+func Scan(c *config.Config, dir string) (report *ScanReport, err error) {
+	c.Logger.Info("Scanning for references from base to target in dir", "base", c.Base, "target", c.Target, "terms", len(c.Terms), "dir", dir)
+	m, err := NewMatcher(c)
+	if err != nil {
+		return nil, err
+	}
+
+	report = &ScanReport{Findings: []Finding{}, Skipped: []SkippedFile{}, rules: Entries(c)}
+	severities := map[string]string{}
+	for _, e := range report.rules {
+		severities[e.RuleID()] = e.RuleSeverity()
+	}
+	// Files are read and matched on the workers, then collected in walk order
+	process := func(path string, rel string, fi os.FileInfo) (interface{}, error) {
+		found, reason, err := findReferences(c, m, path, rel, fi)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			return &fileScan{size: fi.Size(), skip: reason}, nil
+		}
+		return &fileScan{size: fi.Size(), matches: found.matches}, nil
+	}
+	var files int
+	var size int64
+	collect := func(rel string, v interface{}) error {
+		scanned := v.(*fileScan)
+		files++
+		size += scanned.size
+		if scanned.skip != "" {
+			report.Skipped = append(report.Skipped, SkippedFile{Path: rel, Reason: scanned.skip})
+			return nil
+		}
+		report.FilesScanned++
+		for _, match := range scanned.matches {
+			report.Findings = append(report.Findings, Finding{
+				Path:        rel,
+				Line:        match.Line,
+				Column:      match.Column,
+				EndColumn:   match.Column + utf8.RuneCountInString(match.Text),
+				Term:        match.Term.From,
+				Match:       match.Text,
+				Replacement: match.Replacement,
+				Rule:        match.Term.Rule,
+				Severity:    severities[match.Term.Rule],
+			})
+		}
+		return nil
+	}
+
+	start := time.Now()
+	err = WalkRepoParallel(c, dir, process, collect)
+	if err != nil {
+		return nil, err
+	}
+	logThroughput(c.Logger, files, size, start)
+
+	c.Logger.Info("Finished scanning", "filesScanned", report.FilesScanned, "findings", len(report.Findings), "skipped", len(report.Skipped))
+	for _, skipped := range report.Skipped {
+		c.Logger.Info("Skipped the file", "path", skipped.Path, "reason", skipped.Reason)
+	}
+
+	return report, nil
+}
+
+// Render returns the report in the given format
+func (r *ScanReport) Render(format string) (out []byte, err error) {
+	switch format {
+	case FormatText:
+		var buf bytes.Buffer
+		for _, f := range r.Findings {
+			fmt.Fprintf(&buf, "%s:%d:%d: %s -> %s\n", f.Path, f.Line, f.Column, f.Match, f.Replacement)
+		}
+		return buf.Bytes(), nil
+	case FormatJSON:
+		out, err = json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode report as JSON: %w", err)
+		}
+		return append(out, '\n'), nil
+	case FormatCSV:
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		w.Write([]string{"path", "line", "column", "term", "match", "replacement", "rule", "severity"})
+		for _, f := range r.Findings {
+			w.Write([]string{f.Path, strconv.Itoa(f.Line), strconv.Itoa(f.Column), f.Term, f.Match, f.Replacement, f.Rule, f.Severity})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, fmt.Errorf("failed to encode report as CSV: %w", err)
+		}
+		return buf.Bytes(), nil
+	case FormatSARIF:
+		out, err = json.MarshalIndent(r.sarif(), "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode report as SARIF: %w", err)
+		}
+		return append(out, '\n'), nil
+	}
+
+	return nil, fmt.Errorf("unknown format %q, must be one of 'text', 'json', 'csv' or 'sarif'", format)
+}
+
+// Run reports every reference from $base to $target in the repo at $path
+// Example: Find all occurrences of 'master' in the current dir, as JSON
+func (c *ScanCommand) Run(args []string) int {
+	switch c.Config.Format {
+	case FormatText, FormatJSON, FormatCSV, FormatSARIF:
+	default:
+		return c.exitError(fmt.Errorf("unknown format %q, must be one of 'text', 'json', 'csv' or 'sarif'", c.Config.Format))
+	}
+
+	dir, err := filepath.Abs(c.Config.Path)
+	if err != nil {
+		return c.exitError(fmt.Errorf("failed to resolve path %s: %w", c.Config.Path, err))
+	}
+	if fi, err := os.Stat(dir); err != nil || !fi.IsDir() {
+		return c.exitError(fmt.Errorf("path %s is not a directory", c.Config.Path))
+	}
+
+	// Paths ignored by git are never scanned, as with updateRefs on a local checkout
+	ignored, err := readGitignore(dir)
+	if err != nil {
+		return c.exitError(err)
+	}
+	c.Config.Exclusion = append(c.Config.Exclusion, ignored...)
+	applied, err := ApplyPresets(c.Config, dir)
+	if err != nil {
+		return c.exitError(err)
+	}
+
+	report, err := Scan(c.Config, dir)
+	if err != nil {
+		return c.exitError(err)
+	}
+	report.Presets = applied
+
+	out, err := report.Render(c.Config.Format)
+	if err != nil {
+		return c.exitError(err)
+	}
+
+	if c.Config.Output == "" {
+		c.UI.Output(strings.TrimSuffix(string(out), "\n"))
+		return 0
+	}
+	err = ioutil.WriteFile(c.Config.Output, out, 0644)
+	if err != nil {
+		return c.exitError(fmt.Errorf("failed to write report %s: %w", c.Config.Output, err))
+	}
+	c.Config.Logger.Info(message.Success("Wrote the scan report"), "path", c.Config.Output, "format", c.Config.Format)
+
+	return 0
+}
+
+// exitError prints the error to the configured UI Error channel (usually stderr) then
+// returns the exit code.
+func (c *ScanCommand) exitError(err error) int {
+	c.Config.Logger.Error(message.Error(err.Error()))
+	return 1
+}
+
+// Help returns the full help text.
+func (c *ScanCommand) Help() string {
+	return `Usage: inclusify scan path base target
+	Report every reference from base to target in the repo at path, without modifying anything.
+	Files are excluded and skipped exactly as they are by updateRefs. A GitHub token is not required.
+	Flags:
+	--path="."       The local repo to scan.
+	--base="master"  The name of the current base branch, e.g. 'master'.
+	--target="main"  The name of the target branch, e.g. 'main'.
+	--exclusion      Gitignore-style patterns of paths to exclude, relative to the repo root.
+	--presets="auto" Exclusion presets for the dependencies and lockfiles of an ecosystem, e.g.
+	                 'node,terraform', 'auto' to detect them or 'none'. The applied presets are
+	                 listed in the JSON report.
+	--include        Gitignore-style patterns of the only paths to scan.
+	--ci-only        Only scan CI and automation config files, in addition to any --include patterns.
+	--structured-ci  Only report branch filters in GitHub Actions, CircleCI, Travis and GoReleaser configs.
+	--terms          Path to a JSON dictionary of additional terms to report.
+	--match-mode="identifier"  How references are matched: 'identifier', 'word' or 'substring'.
+	--case-sensitive Only match the exact case of each term.
+	--allowlist      Phrases that are never reported, e.g. 'master key,mastermind'.
+	--max-file-size=1048576  Files larger than this many bytes are skipped, 0 disables the limit.
+	--workers=0      How many files are read at once, 0 uses the number of CPUs.
+	--format="text"  The format of the report: 'text', 'json', 'csv' or 'sarif'. SARIF 2.1.0 reports
+	                 can be uploaded to GitHub code scanning and other security dashboards.
+	--output         Write the report to this file instead of printing it.
+	`
+}
+
+// Synopsis returns a sub 50 character summary of the command.
+func (c *ScanCommand) Synopsis() string {
+	return "Report references from base to target without modifying anything. [subcommand]"
+}
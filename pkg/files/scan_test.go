@@ -0,0 +1,144 @@
+// +build !integration
+
+package files
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/inclusify/pkg/terms"
+)
+
+func newTestScanCommand(ui *cli.MockUi, dir, format string) *ScanCommand {
+	c := newTestUpdateRefsCommand(ui).Config
+	c.Path = dir
+	c.Format = format
+	c.Logger = hclog.New(&hclog.LoggerOptions{Output: ui.ErrorWriter})
+	return &ScanCommand{Config: c, UI: ui}
+}
+
+// Test that every reference is reported, and that nothing is modified
+func Test_Scan(t *testing.T) {
+	ui := cli.NewMockUi()
+	files := map[string]string{
+		".gitignore":         "node_modules/\n",
+		"Makefile":           "BRANCH ?= master\n",
+		"docs/setup.md":      "Clone the repo\nthen run `git checkout master` on master\n",
+		"node_modules/x.js":  "master",
+		"assets/logo.png":    "\x89PNG\r\n\x1a\n\x00\x00master",
+		"docs/mastermind.md": "mastermind",
+	}
+	dir := writeTestFiles(t, files, 0644)
+	defer os.RemoveAll(dir)
+	c := newTestScanCommand(ui, dir, FormatJSON)
+
+	require.Equal(t, 0, c.Run([]string{}), ui.ErrorWriter.String())
+
+	var report ScanReport
+	require.NoError(t, json.Unmarshal(ui.OutputWriter.Bytes(), &report), ui.OutputWriter.String())
+	assert.Equal(t, []Finding{
+		{Path: "Makefile", Line: 1, Column: 11, EndColumn: 17, Term: "master", Match: "master", Replacement: "main", Rule: terms.BranchRuleID, Severity: terms.SeverityWarning},
+		{Path: "docs/setup.md", Line: 2, Column: 24, EndColumn: 30, Term: "master", Match: "master", Replacement: "main", Rule: terms.BranchRuleID, Severity: terms.SeverityWarning},
+		{Path: "docs/setup.md", Line: 2, Column: 35, EndColumn: 41, Term: "master", Match: "master", Replacement: "main", Rule: terms.BranchRuleID, Severity: terms.SeverityWarning},
+	}, report.Findings)
+	assert.Equal(t, []SkippedFile{{Path: "assets/logo.png", Reason: SkipBinary}}, report.Skipped)
+	assert.Equal(t, 4, report.FilesScanned)
+
+	for name, content := range files {
+		read, err := ioutil.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		require.NoError(t, err)
+		assert.Equal(t, content, string(read))
+	}
+}
+
+// Test the text and CSV reports
+func Test_ScanReport_Render(t *testing.T) {
+	report := &ScanReport{Findings: []Finding{
+		{Path: "docs/a, b.md", Line: 3, Column: 5, EndColumn: 16, Term: "whitelist", Match: "Whitelisted", Replacement: "Allowlisted", Rule: "whitelist", Severity: terms.SeverityNote},
+	}}
+
+	text, err := report.Render(FormatText)
+	require.NoError(t, err)
+	assert.Equal(t, "docs/a, b.md:3:5: Whitelisted -> Allowlisted\n", string(text))
+
+	csv, err := report.Render(FormatCSV)
+	require.NoError(t, err)
+	assert.Equal(t, "path,line,column,term,match,replacement,rule,severity\n\"docs/a, b.md\",3,5,whitelist,Whitelisted,Allowlisted,whitelist,note\n", string(csv))
+
+	_, err = report.Render("xml")
+	assert.Error(t, err)
+}
+
+// Test that detected presets are applied and reported, and that their paths can be re-included
+func Test_Scan_Presets(t *testing.T) {
+	ui := cli.NewMockUi()
+	dir := writeTestFiles(t, map[string]string{
+		"package.json":              `{"scripts": {"release": "git push origin master"}}`,
+		"package-lock.json":         `{"resolved": "https://example.com/master.tgz"}`,
+		"yarn.lock":                 "master\n",
+		"node_modules/a/a.js":       "master",
+		"infra/main.tf":             `branch = "master"`,
+		"infra/.terraform.lock.hcl": "master",
+	}, 0644)
+	defer os.RemoveAll(dir)
+	c := newTestScanCommand(ui, dir, FormatJSON)
+	c.Config.Presets = []string{"auto"}
+	c.Config.Exclusion = append(c.Config.Exclusion, "!yarn.lock")
+
+	require.Equal(t, 0, c.Run([]string{}), ui.ErrorWriter.String())
+
+	var report ScanReport
+	require.NoError(t, json.Unmarshal(ui.OutputWriter.Bytes(), &report), ui.OutputWriter.String())
+	assert.Equal(t, []string{"node", "terraform"}, report.Presets)
+	var paths []string
+	for _, f := range report.Findings {
+		paths = append(paths, f.Path)
+	}
+	assert.Equal(t, []string{"infra/main.tf", "package.json", "yarn.lock"}, paths)
+}
+
+// Test that findings are reported as SARIF results with rules from the dictionary
+func Test_ScanReport_SARIF(t *testing.T) {
+	report := &ScanReport{
+		Findings: []Finding{
+			{Path: "docs/a.md", Line: 3, Column: 5, EndColumn: 16, Term: "whitelist", Match: "Whitelisted", Replacement: "Allowlisted", Rule: "IL001", Severity: terms.SeverityError},
+		},
+		rules: []terms.Entry{
+			terms.Branch("master", "main"),
+			{Term: "whitelist", Replacement: "allowlist", ID: "IL001", Severity: terms.SeverityError},
+		},
+	}
+
+	out, err := report.Render(FormatSARIF)
+	require.NoError(t, err)
+
+	var log sarifLog
+	require.NoError(t, json.Unmarshal(out, &log))
+	assert.Equal(t, "2.1.0", log.Version)
+	require.Len(t, log.Runs, 1)
+	run := log.Runs[0]
+
+	require.Len(t, run.Tool.Driver.Rules, 2)
+	assert.Equal(t, terms.BranchRuleID, run.Tool.Driver.Rules[0].ID)
+	assert.Equal(t, "IL001", run.Tool.Driver.Rules[1].ID)
+	assert.Equal(t, "'whitelist' should be replaced with 'allowlist'", run.Tool.Driver.Rules[1].ShortDescription.Text)
+	assert.Equal(t, terms.SeverityError, run.Tool.Driver.Rules[1].DefaultConfiguration.Level)
+
+	require.Len(t, run.Results, 1)
+	result := run.Results[0]
+	assert.Equal(t, "IL001", result.RuleID)
+	assert.Equal(t, 1, result.RuleIndex)
+	assert.Equal(t, terms.SeverityError, result.Level)
+	region := result.Locations[0].PhysicalLocation.Region
+	assert.Equal(t, sarifRegion{StartLine: 3, StartColumn: 5, EndLine: 3, EndColumn: 16, Snippet: &sarifMessage{Text: "Whitelisted"}}, region)
+	assert.Equal(t, "docs/a.md", result.Fixes[0].ArtifactChanges[0].ArtifactLocation.URI)
+	assert.Equal(t, "Allowlisted", result.Fixes[0].ArtifactChanges[0].Replacements[0].InsertedContent.Text)
+}
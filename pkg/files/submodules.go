@@ -0,0 +1,183 @@
+package files
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+
+	"github.com/hashicorp/inclusify/pkg/branches"
+	"github.com/hashicorp/inclusify/pkg/gitmodules"
+	"github.com/hashicorp/inclusify/pkg/links"
+	"github.com/hashicorp/inclusify/pkg/matcher"
+	"github.com/hashicorp/inclusify/pkg/message"
+)
+
+// submodulePull is the PR opened in a same-org submodule, or why its migration
+// failed
+type submodulePull struct {
+	Owner string
+	Repo  string
+	Pull  *github.PullRequest
+	Err   error
+}
+
+// checkGitmodules only keeps the matches in the 'branch' of each submodule in
+// .gitmodules, and only if the new branch exists in the submodule's repo, or
+// was created by migrating it in this run. Everything else in the file, such as
+// the path or url of a submodule, names something we can't rename, so it is
+// returned for manual review.
+func (c *UpdateRefsCommand) checkGitmodules(resolver *links.Resolver, rel string, text []byte, matches []matcher.Match) (kept []matcher.Match, flagged []FlaggedLink) {
+	submodules := gitmodules.Parse(text)
+
+	inBranch := map[int][]matcher.Match{}
+	for _, match := range matches {
+		found := false
+		for i, sub := range submodules {
+			if sub.BranchStart <= match.Start && match.End <= sub.BranchEnd {
+				inBranch[i] = append(inBranch[i], match)
+				found = true
+				break
+			}
+		}
+		if !found {
+			flagged = append(flagged, FlaggedLink{Path: rel, Line: match.Line, Reason: fmt.Sprintf("'%s' is not the branch of a submodule", match.Text)})
+		}
+	}
+
+	for i, sub := range submodules {
+		subMatches, ok := inBranch[i]
+		if !ok {
+			continue
+		}
+		branch := string(matcher.Apply([]byte(sub.Branch), shift(subMatches, -sub.BranchStart)))
+		reason := c.checkSubmoduleBranch(resolver, sub, branch)
+		if reason == "" {
+			kept = append(kept, subMatches...)
+			continue
+		}
+		flagged = append(flagged, FlaggedLink{Path: rel, Line: subMatches[0].Line, URL: sub.URL, Reason: reason})
+	}
+
+	// Keep the matches in order, as they were found
+	sort.Slice(kept, func(i, j int) bool { return kept[i].Start < kept[j].Start })
+
+	return kept, flagged
+}
+
+// checkSubmoduleBranch returns why the branch of a submodule can't be changed
+// to branch, or an empty string if it can
+func (c *UpdateRefsCommand) checkSubmoduleBranch(resolver *links.Resolver, sub gitmodules.Submodule, branch string) string {
+	owner, repo, ok := gitmodules.RepoOnHost(sub.URL, c.Config.GitHost, c.Config.Owner, c.Config.Repo)
+	if !ok {
+		return fmt.Sprintf("could not check that branch '%s' exists in submodule %s, which is not on GitHub", branch, sub.Name)
+	}
+	for _, migrated := range c.submodules {
+		if migrated.Err == nil && strings.EqualFold(migrated.Owner, owner) && strings.EqualFold(migrated.Repo, repo) && branch == c.Config.Target {
+			return ""
+		}
+	}
+	if resolver == nil {
+		return fmt.Sprintf("could not check that branch '%s' exists in %s/%s without a GitHub token", branch, owner, repo)
+	}
+	exists, err := resolver.BranchExists(owner, repo, branch)
+	if err != nil {
+		return fmt.Sprintf("could not check that branch '%s' exists: %s", branch, err)
+	}
+	if !exists {
+		return fmt.Sprintf("branch '%s' does not exist in %s/%s", branch, owner, repo)
+	}
+
+	return ""
+}
+
+// migrateSubmodules runs the whole migration for every submodule in the cloned
+// repo at dir that is owned by the same org: it creates the $target and
+// $tmpBranch branches, updates the references and opens a PR. Submodules of
+// submodules are not migrated. A submodule that fails is logged and listed in
+// the PR body with its error, so it can be migrated manually.
+func (c *UpdateRefsCommand) migrateSubmodules(dir string) (err error) {
+	read, err := ioutil.ReadFile(filepath.Join(dir, ".gitmodules"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read .gitmodules: %w", err)
+	}
+
+	seen := map[string]bool{strings.ToLower(c.Config.Owner + "/" + c.Config.Repo): true}
+	for _, sub := range gitmodules.Parse(read) {
+		owner, repo, ok := gitmodules.RepoOnHost(sub.URL, c.Config.GitHost, c.Config.Owner, c.Config.Repo)
+		if !ok || !strings.EqualFold(owner, c.Config.Owner) {
+			c.Config.Logger.Info("Skipping submodule that is not owned by the same org", "submodule", sub.Name, "url", sub.URL)
+			continue
+		}
+		key := strings.ToLower(owner + "/" + repo)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		c.Config.Logger.Info(message.Info("Migrating submodule"), "submodule", sub.Name, "repo", repo)
+		pr, err := c.migrateSubmodule(owner, repo)
+		if err != nil {
+			c.Config.Logger.Info(message.Warn("Failed to migrate submodule, skipping it"), "submodule", sub.Name, "repo", repo, "error", err)
+		}
+		c.submodules = append(c.submodules, submodulePull{Owner: owner, Repo: repo, Pull: pr, Err: err})
+	}
+
+	return nil
+}
+
+// migrateSubmodule runs the migration for a single submodule repo
+func (c *UpdateRefsCommand) migrateSubmodule(owner, repo string) (pr *github.PullRequest, err error) {
+	subConfig := *c.Config
+	subConfig.Owner = owner
+	subConfig.Repo = repo
+	subConfig.Submodules = false
+	subConfig.Exclusion = append([]string(nil), c.Config.Exclusion...)
+	subConfig.Logger = c.Config.Logger.Named(repo)
+
+	if !subConfig.DryRun {
+		create := &branches.CreateCommand{Config: &subConfig, GithubClient: c.GithubClient, BranchesList: []string{c.TempBranch}}
+		if create.Run(nil) != 0 {
+			return nil, fmt.Errorf("failed to create branches in %s/%s", owner, repo)
+		}
+	}
+
+	sub := &UpdateRefsCommand{Config: &subConfig, GithubClient: c.GithubClient, UI: c.UI, TempBranch: c.TempBranch}
+	return sub.migrate()
+}
+
+// linkSubmodulePulls adds a link to the PR in this repo to each submodule PR
+func (c *UpdateRefsCommand) linkSubmodulePulls(pr *github.PullRequest) {
+	for _, sub := range c.submodules {
+		if sub.Pull == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		body := sub.Pull.GetBody() + fmt.Sprintf("<br /><br />This PR is a submodule of %s/%s, which is updated in %s", c.Config.Owner, c.Config.Repo, pr.GetHTMLURL())
+		_, _, err := c.GithubClient.GetPRs().Edit(ctx, sub.Owner, sub.Repo, sub.Pull.GetNumber(), &github.PullRequest{Body: &body})
+		cancel()
+		if err != nil {
+			c.Config.Logger.Info(message.Warn("Failed to link the submodule PR"), "repo", sub.Repo, "url", sub.Pull.GetHTMLURL(), "error", err)
+		}
+	}
+}
+
+// shift returns copies of the matches with their offsets moved by delta
+func shift(matches []matcher.Match, delta int) []matcher.Match {
+	shifted := make([]matcher.Match, len(matches))
+	for i, match := range matches {
+		match.Start += delta
+		match.End += delta
+		shifted[i] = match
+	}
+	return shifted
+}
@@ -1,24 +1,31 @@
 package files
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/dchest/uniuri"
 	git "github.com/go-git/go-git/v5"
+	gitConfig "github.com/go-git/go-git/v5/config"
 	plumbing "github.com/go-git/go-git/v5/plumbing"
-	object "github.com/go-git/go-git/v5/plumbing/object"
-	http "github.com/go-git/go-git/v5/plumbing/transport/http"
+	transport "github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/google/go-github/v32/github"
+	"github.com/mitchellh/cli"
 
+	"github.com/hashicorp/inclusify/pkg/ciconfig"
 	"github.com/hashicorp/inclusify/pkg/config"
 	"github.com/hashicorp/inclusify/pkg/gh"
+	"github.com/hashicorp/inclusify/pkg/links"
+	"github.com/hashicorp/inclusify/pkg/matcher"
 	"github.com/hashicorp/inclusify/pkg/message"
+	"github.com/hashicorp/inclusify/pkg/remote"
+	"github.com/hashicorp/inclusify/pkg/terms"
+	"github.com/hashicorp/inclusify/pkg/workspace"
 )
 
 // UpdateRefsCommand is a struct used to configure a Command for updating
@@ -26,120 +33,395 @@ import (
 type UpdateRefsCommand struct {
 	Config       *config.Config
 	GithubClient gh.GithubInteractor
+	UI           cli.Ui
 	TempBranch   string
+
+	// submodules are the repos of same-org submodules migrated alongside this repo
+	submodules []submodulePull
+	// presets are the names of the exclusion presets applied to this repo
+	presets []string
+	// lease is the commit $tmpBranch was at on the remote when the repo was cloned
+	lease plumbing.Hash
 }
 
-// CloneRepo creates a temp directory and clones the repo at $tmpBranch into it
-func CloneRepo(c *UpdateRefsCommand) (repoRef *git.Repository, dir string, err error) {
-	pwd, err := os.Getwd()
+// CloneRepo creates a workspace and clones the repo at $target into it, so that
+// the changes are always made on top of the current $target, even on re-runs. The
+// workspace must be closed once it's no longer needed.
+func CloneRepo(c *UpdateRefsCommand) (ws *workspace.Workspace, err error) {
+	prefix := fmt.Sprintf("tmp-clone-%s", uniuri.NewLen(6))
+	c.Config.Logger.Info("Creating workspace", "dirPrefix", prefix, "inMemoryObjects", c.Config.InMemoryObjects)
+	ws, err = workspace.New(workspaceOptions(c.Config), prefix)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to get current working directory: %w", err)
+		return nil, err
 	}
 
-	prefix := fmt.Sprintf("tmp-clone-%s", uniuri.NewLen(6))
-	c.Config.Logger.Info("Creating local temp dir", "dirPrefix", prefix)
-	dir, err = ioutil.TempDir(pwd, prefix)
+	opts := remoteOptions(c.Config)
+	url := opts.URL(c.Config.Owner, c.Config.Repo)
+	auth, err := opts.Auth(url)
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to create tmp directory: %w", err)
+		ws.Close()
+		return nil, err
 	}
-
-	url := fmt.Sprintf("https://github.com/%s/%s.git", c.Config.Owner, c.Config.Repo)
-	refName := fmt.Sprintf("refs/heads/%s", c.TempBranch)
-	repo, err := git.PlainClone(dir, false, &git.CloneOptions{
-		URL: url,
-		Auth: &http.BasicAuth{
-			Username: "irrelevant", // This cannot be an empty string
-			Password: c.Config.Token,
-		},
+	refName := fmt.Sprintf("refs/heads/%s", c.Config.Target)
+	c.Config.Logger.Info("Cloning repo", "url", url, "auth", opts.Method, "depth", c.Config.CloneDepth)
+	err = ws.Clone(&git.CloneOptions{
+		URL:           url,
+		Auth:          auth,
 		ReferenceName: plumbing.ReferenceName(refName),
 	})
 	if err != nil {
-		return nil, "", fmt.Errorf("failed to clone repo %s %s %w", url, refName, err)
+		ws.Close()
+		return nil, err
 	}
 
-	c.Config.Logger.Info(message.Success("Successfully cloned repo into local dir"), "repo", c.Config.Repo, "dir", dir)
+	c.Config.Logger.Info(message.Success("Successfully cloned repo into local dir"), "repo", c.Config.Repo, "dir", ws.Dir)
 
-	return repo, dir, nil
+	return ws, nil
 }
 
-// UpdateReferences walks through the files in the cloned repo, and updates references from
-// $base to $target. It excludes any paths from `INCLUSIFY_PATH_EXCLUSION`
-func UpdateReferences(c *UpdateRefsCommand, dir string) (filesChanged bool, err error) {
-	c.Config.Logger.Info("Finding and replacing all references from base to target in dir", "base", c.Config.Base, "target", c.Config.Target, "dir", dir)
-	// Set a flag to false, and update it to true if any files are modified.
-	filesChanged = false
-	// Walk through the directories/files in the tmp directory, $dir, where the repo was cloned
-	callback := func(path string, fi os.FileInfo, err error) error {
-		// Skip directories and files that should be excluded
-		if len(c.Config.Exclusion) > 0 {
-			for _, fp := range c.Config.Exclusion {
-				if strings.Contains(path, fp) {
-					return nil
-				}
-			}
+// workspaceOptions returns where repos are cloned, from the `INCLUSIFY_WORKSPACE_DIR`,
+// `INCLUSIFY_IN_MEMORY_OBJECTS` and `INCLUSIFY_CLONE_DEPTH` inputs
+func workspaceOptions(c *config.Config) workspace.Options {
+	return workspace.Options{
+		Dir:             c.WorkspaceDir,
+		InMemoryObjects: c.InMemoryObjects,
+		Depth:           c.CloneDepth,
+	}
+}
+
+// remoteOptions returns how the remote is reached, from the `INCLUSIFY_GIT_AUTH`,
+// `INCLUSIFY_REMOTE_URL` and SSH inputs
+func remoteOptions(c *config.Config) remote.Options {
+	return remote.Options{
+		Method:           c.GitAuth,
+		URLTemplate:      c.RemoteURL,
+		Host:             c.GitHost,
+		Token:            c.Token,
+		SSHKey:           c.SSHKey,
+		SSHKeyPassphrase: c.SSHKeyPassphrase,
+		SSHKnownHosts:    c.SSHKnownHosts,
+	}
+}
+
+// remoteAuth returns the auth method for the remote named name in repo
+func remoteAuth(c *config.Config, repo *git.Repository, name string) (auth transport.AuthMethod, err error) {
+	r, err := repo.Remote(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get remote %s: %w", name, err)
+	}
+	return remoteOptions(c).Auth(r.Config().URLs[0])
+}
+
+// remoteBranch returns the commit at the tip of branch on the origin of repo, or
+// the zero hash if the branch doesn't exist there
+func remoteBranch(c *config.Config, repo *git.Repository, branch string) (sha plumbing.Hash, err error) {
+	auth, err := remoteAuth(c, repo, git.DefaultRemoteName)
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	r, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to get remote %s: %w", git.DefaultRemoteName, err)
+	}
+	refs, err := r.List(&git.ListOptions{Auth: auth})
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("failed to list the branches of the remote: %w", err)
+	}
+
+	name := plumbing.NewBranchReferenceName(branch)
+	for _, ref := range refs {
+		if ref.Name() == name {
+			return ref.Hash(), nil
 		}
-		// Find and replace within the repo's files
-		if !fi.IsDir() {
-			read, err := ioutil.ReadFile(path)
-			if err != nil {
-				return err
-			}
-			// Find and replace all references from $base to $target within the files
-			newContents := strings.ReplaceAll(string(read), c.Config.Base, c.Config.Target)
-			// Set flag to true if the file was modified
-			if newContents != string(read) {
-				filesChanged = true
-			}
-			// Update the file with the new contents
-			err = ioutil.WriteFile(path, []byte(newContents), 0)
-			if err != nil {
-				return err
-			}
-			c.Config.Logger.Info("Updated the file", "path", path)
+	}
+	return plumbing.ZeroHash, nil
+}
+
+// Entries returns the dictionary entries for the references from $base to
+// $target, followed by any other terms from the dictionary
+func Entries(c *config.Config) []terms.Entry {
+	return append([]terms.Entry{terms.Branch(c.Base, c.Target)}, c.Terms...)
+}
+
+// NewMatcher builds the matcher used to find references from $base to $target,
+// and any other terms from the dictionary, honoring the configured match mode, case sensitivity and allowlist
+func NewMatcher(c *config.Config) (m *matcher.Matcher, err error) {
+	mode := c.MatchMode
+	if mode == "" {
+		mode = matcher.ModeIdentifier
+	}
+	m, err = matcher.New(terms.Expand(Entries(c)), mode, c.CaseSensitive, c.Allowlist)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up reference matcher: %w", err)
+	}
+
+	return m, nil
+}
+
+// FileChange is a file that was modified by UpdateReferences, along with
+// every replacement that was made in it
+type FileChange struct {
+	Path    string
+	Matches []matcher.Match
+
+	original []byte
+	updated  []byte
+}
+
+// Result summarizes the files touched by UpdateReferences. Paths are relative
+// to the root of the repo.
+type Result struct {
+	Changed []FileChange
+	Skipped []SkippedFile
+	Flagged []FlaggedLink
+}
+
+// Replacements returns the total number of replacements made across all files
+func (r *Result) Replacements() (count int) {
+	for _, change := range r.Changed {
+		count += len(change.Matches)
+	}
+	return count
+}
+
+// FilesChanged returns true if any file was modified
+func (r *Result) FilesChanged() bool {
+	return len(r.Changed) > 0
+}
+
+// Diff returns the changes in unified diff format, colorized if color is true.
+// UTF-16 files are shown as UTF-8 text when color is true, and otherwise as git
+// binary patches of their actual bytes, so that the diff can be applied with
+// `git apply`.
+func (r *Result) Diff(color bool) string {
+	var diff strings.Builder
+	for _, change := range r.Changed {
+		if !color && isUTF16(change.original) {
+			diff.WriteString(BinaryDiff(change.Path, change.original, change.updated))
+			continue
 		}
-		return nil
+		diff.WriteString(UnifiedDiff(change.Path, displayText(change.original), displayText(change.updated), color))
 	}
+	return diff.String()
+}
 
-	err = filepath.Walk(dir, callback)
+// branchMatches keeps only the matches of $base that name a branch in the
+// structure of a CI config, e.g. in 'on.push.branches' for GitHub Actions
+func branchMatches(c *config.Config, provider ciconfig.Provider, text []byte, matches []matcher.Match) ([]matcher.Match, error) {
+	ranges, err := ciconfig.BranchRanges(provider, text)
 	if err != nil {
-		return false, err
+		return nil, err
+	}
+
+	var kept []matcher.Match
+	for _, match := range matches {
+		// Branch names are case-sensitive, so only an exact match names the branch
+		if match.Term.From != c.Base || match.Text != c.Base {
+			continue
+		}
+		for _, r := range ranges {
+			if r.Contains(match.Start, match.End) {
+				kept = append(kept, match)
+				break
+			}
+		}
 	}
 
-	return filesChanged, nil
+	return kept, nil
+}
+
+// foundFile holds the references found in a single file, along with its raw
+// and decoded contents so that they can be rewritten in the original encoding
+type foundFile struct {
+	raw     []byte
+	text    []byte
+	enc     textEncoding
+	matches []matcher.Match
 }
 
-// GitPush adds, commits, and pushes all changes to $tmpBranch
-func GitPush(c *UpdateRefsCommand, tmpBranch string, repo *git.Repository, dir string) (err error) {
-	worktree, err := repo.Worktree()
+// findReferences reads the file and finds every reference in it, or returns the
+// reason the file must be skipped. Binary, Git LFS, generated and oversized
+// files are skipped, and so are CI configs that fail to parse in
+// structured mode.
+func findReferences(c *config.Config, m *matcher.Matcher, path, rel string, fi os.FileInfo) (found *foundFile, skip string, err error) {
+	// Skip files that cannot be safely rewritten as text
+	if reason := skipReasonForFile(fi, c.MaxFileSize); reason != "" {
+		return nil, reason, nil
+	}
+	read, reason, err := readFile(path, fi.Size())
+	if err != nil || reason != "" {
+		return nil, reason, err
+	}
+	text, enc, err := decodeText(read)
+	if err != nil || !bytes.Equal(encodeText(text, enc), read) {
+		// UTF-16 that does not survive a round trip is treated as binary, so we never corrupt it
+		return nil, SkipBinary, nil
+	}
+	if reason := skipReasonForContent(text); reason != "" {
+		return nil, reason, nil
+	}
+
+	// Find all references from $base to $target within the file
+	matches := m.Find(text)
+	if provider := ciconfig.Detect(rel); c.StructuredCI && provider != "" && len(matches) > 0 {
+		matches, err = branchMatches(c, provider, text, matches)
+		if err != nil {
+			c.Logger.Info(message.Warn("Failed to parse CI config"), "path", rel, "error", err)
+			return nil, SkipInvalidCI, nil
+		}
+	}
+
+	return &foundFile{raw: read, text: text, enc: enc, matches: matches}, "", nil
+}
+
+// fileUpdate is the outcome of updating a single file in UpdateReferences
+type fileUpdate struct {
+	size    int64
+	skip    string
+	flagged []FlaggedLink
+	change  *FileChange
+}
+
+// UpdateReferences walks through the files in the cloned repo, and updates references from
+// $base to $target. It excludes any paths from `INCLUSIFY_PATH_EXCLUSION`, and skips binary,
+// Git LFS, generated and oversized files. In dry-run mode, no files are written.
+// Files are processed by `INCLUSIFY_WORKERS` workers at once.
+func UpdateReferences(c *UpdateRefsCommand, dir string) (result *Result, err error) {
+	c.Config.Logger.Info("Finding and replacing all references from base to target in dir", "base", c.Config.Base, "target", c.Config.Target, "terms", len(c.Config.Terms), "dir", dir)
+	m, err := NewMatcher(c.Config)
 	if err != nil {
-		return fmt.Errorf("failed to get worktree: %w", err)
+		return nil, err
+	}
+	if len(c.Config.Include) > 0 {
+		c.Config.Logger.Info("Only updating files that match the include patterns", "include", strings.Join(c.Config.Include, ","))
 	}
+	// Links to other repos are only rewritten if the new branch exists, which needs the GitHub API
+	var resolver *links.Resolver
+	if c.Config.Token != "" {
+		resolver = links.NewResolver(c.GithubClient)
+	}
+	result = &Result{}
+	// Files are read, checked and rewritten on the workers, then collected in walk
+	// order so that the result and the logs are the same on every run
+	process := func(path string, rel string, fi os.FileInfo) (interface{}, error) {
+		update := &fileUpdate{size: fi.Size()}
+		found, reason, err := findReferences(c.Config, m, path, rel, fi)
+		if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			update.skip = reason
+			return update, nil
+		}
+		var flagged []FlaggedLink
+		if rel == ".gitmodules" && len(found.matches) > 0 {
+			found.matches, flagged = c.checkGitmodules(resolver, rel, found.text, found.matches)
+			update.flagged = append(update.flagged, flagged...)
+		}
+		if c.Config.CheckLinks && len(found.matches) > 0 {
+			found.matches, flagged = c.checkLinks(resolver, rel, found.text, found.matches)
+			update.flagged = append(update.flagged, flagged...)
+		}
+		// Only touch the files that actually contain any references
+		if len(found.matches) == 0 {
+			return update, nil
+		}
+		updated := encodeText(matcher.Apply(found.text, found.matches), found.enc)
+		update.change = &FileChange{Path: rel, Matches: found.matches, original: found.raw, updated: updated}
+		if c.Config.DryRun {
+			return update, nil
+		}
+		err = writeFile(path, updated, fi.Mode())
+		if err != nil {
+			return nil, fmt.Errorf("failed to update file %s: %w", rel, err)
+		}
 
-	c.Config.Logger.Info("Running `git add ", dir, "`")
-	_, err = worktree.Add(".")
+		return update, nil
+	}
+	var files int
+	var size int64
+	collect := func(rel string, v interface{}) error {
+		update := v.(*fileUpdate)
+		files++
+		size += update.size
+		if update.skip != "" {
+			result.Skipped = append(result.Skipped, SkippedFile{Path: rel, Reason: update.skip})
+			return nil
+		}
+		for _, flag := range update.flagged {
+			c.Config.Logger.Info(message.Warn("Left a reference untouched"), "path", flag.Path, "line", flag.Line, "url", flag.URL, "reason", flag.Reason)
+		}
+		result.Flagged = append(result.Flagged, update.flagged...)
+		if update.change == nil {
+			return nil
+		}
+		result.Changed = append(result.Changed, *update.change)
+		if c.Config.DryRun {
+			c.Config.Logger.Info("Found references in the file", "path", rel, "replacements", len(update.change.Matches))
+		} else {
+			c.Config.Logger.Info("Updated the file", "path", rel, "replacements", len(update.change.Matches))
+		}
+		return nil
+	}
+
+	// Walk through the directories/files in the tmp directory, $dir, where the repo was cloned
+	start := time.Now()
+	err = WalkRepoParallel(c.Config, dir, process, collect)
 	if err != nil {
-		return fmt.Errorf("failed to `git add %s`: %w", dir, err)
+		return nil, err
 	}
+	logThroughput(c.Config.Logger, files, size, start)
 
-	c.Config.Logger.Info("Committing changes")
-	commitMsg := fmt.Sprintf("Update references from %s to %s", c.Config.Base, c.Config.Target)
-	commitSha, err := worktree.Commit(commitMsg, &git.CommitOptions{
-		Author: &object.Signature{
-			When: time.Now(),
-		},
-	})
+	c.Config.Logger.Info("Finished updating references", "filesChanged", len(result.Changed), "replacements", result.Replacements(), "flaggedLinks", len(result.Flagged))
+	if len(result.Skipped) > 0 {
+		c.Config.Logger.Info(message.Warn("Skipped files that cannot be safely updated"), "count", len(result.Skipped))
+		for _, skipped := range result.Skipped {
+			c.Config.Logger.Info("Skipped the file", "path", skipped.Path, "reason", skipped.Reason)
+		}
+	}
+
+	return result, nil
+}
+
+// GitPush adds and commits all changes on top of $target, with a commit per category
+// of files unless `INCLUSIFY_SINGLE_COMMIT` is set, then pushes them to $tmpBranch
+// with the equivalent of `git push --force-with-lease`. Any commits already on
+// $tmpBranch, e.g. from a previous run, are replaced, and the remote rejects the
+// push if $tmpBranch has moved since the repo was cloned.
+func GitPush(c *UpdateRefsCommand, tmpBranch string, repo *git.Repository, result *Result) (err error) {
+	commits, err := commitChanges(c.Config, repo, result)
 	if err != nil {
-		return fmt.Errorf("failed to commit changes: %w", err)
+		return err
 	}
 
-	c.Config.Logger.Info("Pushing commit to remote", "branch", tmpBranch, "sha", commitSha)
-	err = repo.Push(&git.PushOptions{
-		Auth: &http.BasicAuth{
-			Username: "irrelevant",
-			Password: c.Config.Token,
-		},
-	})
+	auth, err := remoteAuth(c.Config, repo, git.DefaultRemoteName)
+	if err != nil {
+		return err
+	}
+	src, dst := plumbing.NewBranchReferenceName(c.Config.Target), plumbing.NewBranchReferenceName(tmpBranch)
+	opts := &git.PushOptions{
+		RefSpecs: []gitConfig.RefSpec{gitConfig.RefSpec(fmt.Sprintf("%s:%s", src, dst))},
+		Auth:     auth,
+	}
+	// The lease is checked against the refs the remote advertises in the push
+	// itself, so nothing pushed in the meantime can be overwritten. Without a
+	// lease, the branch is only created, and never forced.
+	if !c.lease.IsZero() {
+		opts.RefSpecs[0] = gitConfig.RefSpec("+" + opts.RefSpecs[0])
+		opts.ForceWithLease = &git.ForceWithLease{RefName: dst, Hash: c.lease}
+	}
+
+	c.Config.Logger.Info("Pushing commits to remote", "branch", tmpBranch, "commits", len(commits), "sha", commits[len(commits)-1], "lease", c.lease)
+	err = repo.Push(opts)
+	// A re-run can regenerate the very same commits
+	if err == git.NoErrAlreadyUpToDate {
+		c.Config.Logger.Info("The branch is already up to date", "branch", tmpBranch)
+		return nil
+	}
 	if err != nil {
+		if current, lookupErr := remoteBranch(c.Config, repo, tmpBranch); lookupErr == nil && current != c.lease {
+			return fmt.Errorf("branch %s was updated from %s to %s while the references were being updated, re-run to regenerate the changes on top of it: %w", tmpBranch, c.lease, current, err)
+		}
 		return fmt.Errorf("failed to push changes: %w", err)
 	}
 
@@ -147,18 +429,32 @@ func GitPush(c *UpdateRefsCommand, tmpBranch string, repo *git.Repository, dir s
 }
 
 // OpenPull opens the pull request to merge the changes from $tmpBranch into $target.
-// $tmpBranch is 'update-references', and $target is typically 'main'
-func OpenPull(c *UpdateRefsCommand, tmpBranch string) (err error) {
+// $tmpBranch is 'update-references', and $target is typically 'main'. If the PR is
+// already open, e.g. on a re-run, its title and body are updated instead.
+func OpenPull(c *UpdateRefsCommand, tmpBranch string, result *Result) (pr *github.PullRequest, err error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	var body string
 
 	c.Config.Logger.Info("Setting up PR request")
 	title := fmt.Sprintf("Update References from %s to %s", c.Config.Base, c.Config.Target)
-	if len(c.Config.Exclusion) == 0 {
-		body = fmt.Sprintf("This PR was created to update all references from '%s' to '%s' in this repo.<br /><br />**NOTE**: This PR was generated automatically. Please take a close look before approving and merging!", c.Config.Base, c.Config.Target)
-	} else {
-		body = fmt.Sprintf("This PR was created to update all references from '%s' to '%s' in this repo.<br /><br />The following paths have been excluded: '%v'<br /><br />**NOTE**: This PR was generated automatically. Please take a close look before approving and merging!", c.Config.Base, c.Config.Target, c.Config.Exclusion)
+	body, err = c.pullBody(result)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := findPull(ctx, c, tmpBranch)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		c.Config.Logger.Info(message.Info("Updating the PR that is already open for branch"), "branch", tmpBranch, "target", c.Config.Target, "number", existing.GetNumber())
+		pr, _, err = c.GithubClient.GetPRs().Edit(ctx, c.Config.Owner, c.Config.Repo, existing.GetNumber(), &github.PullRequest{Title: &title, Body: &body})
+		if err != nil {
+			return nil, fmt.Errorf("failed to update PR #%d: %w", existing.GetNumber(), err)
+		}
+		c.Config.Logger.Info(message.Success("Success! Review and merge the updated PR"), "url", pr.GetHTMLURL())
+		return pr, nil
 	}
 
 	modify := true
@@ -171,51 +467,184 @@ func OpenPull(c *UpdateRefsCommand, tmpBranch string) (err error) {
 	}
 
 	c.Config.Logger.Info(message.Info("Creating PR to merge changes from branch into target"), "branch", tmpBranch, "target", c.Config.Target)
-	pr, _, err := c.GithubClient.GetPRs().Create(ctx, c.Config.Owner, c.Config.Repo, pull)
+	pr, _, err = c.GithubClient.GetPRs().Create(ctx, c.Config.Owner, c.Config.Repo, pull)
 	if err != nil {
-		return fmt.Errorf("failed to open PR: %w", err)
+		return nil, fmt.Errorf("failed to open PR: %w", err)
 	}
 	c.Config.Logger.Info(message.Success("Success! Review and merge the open PR"), "url", pr.GetHTMLURL())
 
+	return pr, nil
+}
+
+// findPull returns the open PR from $tmpBranch into $target, or nil if there is none
+func findPull(ctx context.Context, c *UpdateRefsCommand, tmpBranch string) (pr *github.PullRequest, err error) {
+	pulls, _, err := c.GithubClient.GetPRs().List(ctx, c.Config.Owner, c.Config.Repo, &github.PullRequestListOptions{
+		State: "open",
+		Head:  fmt.Sprintf("%s:%s", c.Config.Owner, tmpBranch),
+		Base:  c.Config.Target,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the open PRs from %s: %w", tmpBranch, err)
+	}
+	if len(pulls) == 0 {
+		return nil, nil
+	}
+	return pulls[0], nil
+}
+
+// ShowDiff prints the changes as a colorized diff, or writes them to the
+// configured patch file, without pushing anything to GitHub
+func ShowDiff(c *UpdateRefsCommand, result *Result) (err error) {
+	c.Config.Logger.Info(message.Info("Dry run -- no changes will be pushed and no PR will be opened"), "filesChanged", len(result.Changed), "replacements", result.Replacements())
+	if c.Config.PatchFile == "" {
+		c.UI.Output(result.Diff(true))
+		return nil
+	}
+
+	err = ioutil.WriteFile(c.Config.PatchFile, []byte(result.Diff(false)), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write patch file %s: %w", c.Config.PatchFile, err)
+	}
+	c.Config.Logger.Info(message.Success("Wrote the changes to the patch file, apply it with `git apply`"), "path", c.Config.PatchFile)
+
 	return nil
 }
 
 // Run updates references from $base to $target in the cloned repo
 // Example: Update all occurrences of 'master' to 'main' in ./.github
 func (c *UpdateRefsCommand) Run(args []string) int {
-	repo, dir, err := CloneRepo(c)
+	if c.Config.Path != "" {
+		return c.runLocal()
+	}
+
+	_, err := c.migrate()
 	if err != nil {
 		return c.exitError(err)
 	}
 
+	return 0
+}
+
+// migrate clones the repo, updates references in it along with any same-org
+// submodules, then pushes the changes and opens a PR. It returns the PR, or nil
+// if nothing was opened.
+func (c *UpdateRefsCommand) migrate() (pr *github.PullRequest, err error) {
+	ws, err := CloneRepo(c)
+	if err != nil {
+		return nil, err
+	}
+	defer ws.Close()
+	repo, dir := ws.Repo, ws.Dir
+
 	ref, err := repo.Head()
 	if err != nil {
-		return c.exitError(fmt.Errorf("failed to retrieve HEAD commit: %w", err))
+		return nil, fmt.Errorf("failed to retrieve HEAD commit: %w", err)
+	}
+	c.Config.Logger.Info("Retrieved HEAD commit of branch", "branch", c.Config.Target, "sha", ref.Hash())
+
+	// Remember where $tmpBranch is, so that a previous run's changes can be safely replaced
+	if !c.Config.DryRun {
+		c.lease, err = remoteBranch(c.Config, repo, c.TempBranch)
+		if err != nil {
+			return nil, err
+		}
 	}
-	c.Config.Logger.Info("Retrieved HEAD commit of branch", "branch", c.TempBranch, "sha", ref.Hash())
 
-	filesChanged, err := UpdateReferences(c, dir)
+	// Submodules are migrated first, so that their new branch exists when .gitmodules is updated
+	if c.Config.Submodules {
+		err = c.migrateSubmodules(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Presets are applied after the submodules are migrated, since they detect their own
+	c.presets, err = ApplyPresets(c.Config, dir)
 	if err != nil {
-		return c.exitError(err)
+		return nil, err
+	}
+
+	result, err := UpdateReferences(c, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// Let the operator accept or reject each change before anything is committed
+	if c.Config.Interactive {
+		result, err = Review(c, dir, result)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Exit if no files were modified during the find and replace
-	if !filesChanged {
+	if !result.FilesChanged() {
 		c.Config.Logger.Info(message.Info("Exiting -- No CI files contained base, so there's nothing more to do"), "base", c.Config.Base)
-		return 0
+		return nil, nil
+	}
+
+	// Show the changes instead of pushing them in dry-run mode
+	if c.Config.DryRun {
+		return nil, ShowDiff(c, result)
+	}
+
+	err = GitPush(c, c.TempBranch, repo, result)
+	if err != nil {
+		return nil, err
 	}
 
-	err = GitPush(c, c.TempBranch, repo, dir)
+	pr, err = OpenPull(c, c.TempBranch, result)
+	if err != nil {
+		return nil, err
+	}
+	c.linkSubmodulePulls(pr)
+
+	return pr, nil
+}
+
+// runLocal updates references in the working tree at $path, and either leaves
+// the changes uncommitted or commits them to $localBranch. Nothing is pushed.
+func (c *UpdateRefsCommand) runLocal() int {
+	repo, dir, err := OpenLocalRepo(c)
 	if err != nil {
 		return c.exitError(err)
 	}
 
-	err = OpenPull(c, c.TempBranch)
+	result, err := UpdateReferences(c, dir)
 	if err != nil {
 		return c.exitError(err)
 	}
 
-	defer os.RemoveAll(dir)
+	// Let the operator accept or reject each change before anything is committed
+	if c.Config.Interactive {
+		result, err = Review(c, dir, result)
+		if err != nil {
+			return c.exitError(err)
+		}
+	}
+
+	if !result.FilesChanged() {
+		c.Config.Logger.Info(message.Info("Exiting -- No files contained base, so there's nothing more to do"), "base", c.Config.Base)
+		return 0
+	}
+
+	if c.Config.DryRun {
+		err = ShowDiff(c, result)
+		if err != nil {
+			return c.exitError(err)
+		}
+		return 0
+	}
+
+	if repo == nil {
+		c.Config.Logger.Info(message.Success("Success! Review the uncommitted changes in the local dir"), "dir", dir)
+		return 0
+	}
+
+	err = CommitLocal(c, repo, result)
+	if err != nil {
+		return c.exitError(err)
+	}
 
 	return 0
 }
@@ -231,13 +660,89 @@ func (c *UpdateRefsCommand) exitError(err error) int {
 func (c *UpdateRefsCommand) Help() string {
 	return `Usage: inclusify updateRefs owner repo base target token
 	Update code references from base to target in the given repo. Any dirs/files provided in exclusion will be excluded. Configuration is pulled from the local environment.
+	Re-runs regenerate the changes on top of the current target, force push them to the temporary branch and update the open PR.
 	Flags:
 	--owner          The GitHub org that owns the repo, e.g. 'hashicorp'.
 	--repo           The repository name, e.g. 'circle-codesign'.
 	--base="master"  The name of the current base branch, e.g. 'master'.
 	--target="main"  The name of the target branch, e.g. 'main'.
 	--token          Your Personal GitHub Access Token.
-	--exclusion      Paths to exclude from reference updates.
+	--github-url     The API URL of a GitHub Enterprise Server, e.g.
+	                 'https://github.example.com/api/v3/'. Defaults to github.com.
+	--github-upload-url  The uploads API URL of the GitHub Enterprise Server. Defaults to the one on
+	                 the host of --github-url.
+	--git-host       The host of the git remotes and of the links to other repos. Defaults to the
+	                 host of --github-url, or github.com.
+	--ca-bundle      Path to a PEM file of CA certificates to trust in addition to the system's.
+	--proxy          The URL of the proxy for GitHub API and HTTPS git requests. Defaults to the
+	                 HTTPS_PROXY and NO_PROXY env vars.
+	--git-auth="token"  How to authenticate git clones and pushes: 'token' uses the GitHub token over
+	                 HTTPS, 'ssh-key' uses --ssh-key, such as a deploy key, 'ssh-agent' uses the keys
+	                 in the running ssh-agent, and 'credential-helper' asks git's credential helpers.
+	--remote-url     Template of the git remote URL, where {host}, {owner} and {repo} are replaced,
+	                 e.g. 'ssh://git@{host}/{owner}/{repo}.git'. Defaults to
+	                 'https://{host}/{owner}/{repo}.git', or 'git@{host}:{owner}/{repo}.git' with SSH
+	                 auth.
+	--ssh-key        With --git-auth=ssh-key, path to the private key to clone and push with.
+	--ssh-key-passphrase  The passphrase of the SSH key, if it is protected.
+	--ssh-known-hosts  Path to the known_hosts file used to verify the remote's host key. Defaults
+	                 to $SSH_KNOWN_HOSTS, or ~/.ssh/known_hosts.
+	--exclusion      Gitignore-style patterns of paths to exclude from reference updates, relative
+	                 to the repo root, e.g. '.circleci/,!.circleci/config.yml,/docs/**/*.md'.
+	--presets="auto" Exclusion presets for the dependencies and lockfiles of an ecosystem, e.g.
+	                 'node,terraform'. 'auto' detects them from marker files such as package.json at
+	                 the root of the repo or in its top-level directories, and 'none' disables them.
+	                 Available presets: go, node, php, python, ruby, rust and terraform.
+	--include        Gitignore-style patterns of the only paths to update, e.g. 'Makefile,scripts/'.
+	--ci-only        Only update CI and automation config files, i.e. .circleci/, .github/workflows/,
+	                 .travis.yml, .teamcity.yml, .goreleaser.yml, Jenkinsfile, .gitlab-ci.yml and
+	                 azure-pipelines.yml, in addition to any --include patterns.
+	--structured-ci  Only rewrite branch filters in GitHub Actions, CircleCI, Travis and GoReleaser
+	                 configs, e.g. 'on.push.branches', leaving the rest of those files untouched.
+	--terms          Path to a JSON dictionary of additional terms to replace, e.g. whitelist
+	                 to allowlist, along with the word forms each term lists or opts into.
+	--match-mode="identifier"  How references are matched: 'identifier' respects word, camelCase,
+	                 snake_case and kebab-case boundaries, 'word' respects word boundaries only,
+	                 and 'substring' replaces every occurrence.
+	--case-sensitive Only match the exact case of each term. By default, any case is matched and the
+	                 case is preserved, e.g. 'MASTER_BRANCH' becomes 'MAIN_BRANCH'.
+	--allowlist      Phrases that must never be rewritten, e.g. 'master key,mastermind'.
+	--max-file-size=1048576  Files larger than this many bytes are skipped, 0 disables the limit.
+	                 Binary, Git LFS and generated files are always skipped.
+	--workers=0      How many files are read and rewritten at once, 0 uses the number of CPUs.
+	--path           Update the working tree at this local path instead of cloning the repo. Nothing is
+	                 pushed, and --owner, --repo and --token are not required.
+	--local-branch   With --path, commit the changes to this new local branch instead of leaving them
+	                 uncommitted.
+	--workspace-dir  The dir that repos are cloned into. Defaults to the OS temp dir. The clone is
+	                 always removed when inclusify exits, including when it's interrupted.
+	--in-memory-objects  Keep the git objects and refs of cloned repos in memory instead of a .git
+	                 dir. The working tree is still checked out to --workspace-dir, since the
+	                 files are rewritten in place.
+	--clone-depth=0  Shallow clone repos to this many commits from the tip of the branch, 0 clones
+	                 the whole history. Only the branch that is updated is ever cloned.
+	--check-links=true  Only rewrite the branch in links to other GitHub repos if the new branch exists
+	                 in that repo, and list the rest in the PR for manual review. Links to other repos
+	                 are never rewritten without a token.
+	--submodules     Also migrate submodules owned by the same org: create their branches, update their
+	                 references and open a PR in each, linked to the PR in this repo. Submodules that
+	                 fail are listed in the PR. Without this, the contents of submodules are never
+	                 updated, only their branch in .gitmodules.
+	--dry-run        Show the changes as a diff instead of pushing them and opening a PR.
+	--interactive    Review each change with a few lines of context, and accept, reject or edit it.
+	                 Only the accepted changes are committed.
+	--single-commit  Commit all changes at once. By default, there is a commit per category of files:
+	                 CI configuration, documentation, scripts, source code and other files.
+	--author-name="inclusify"  The name of the author of the commits.
+	--author-email="inclusify@users.noreply.github.com"  The email of the author of the commits.
+	--committer-name, --committer-email  The committer of the commits, which defaults to the author.
+	--signoff        Add a DCO 'Signed-off-by' trailer for the committer to each commit.
+	--signing-key    Path to a private key to sign the commits with, e.g. '~/.ssh/id_ed25519'.
+	--signing-format="openpgp"  The format of the signing key: 'openpgp' (or 'gpg') for an
+	                 exported GPG private key, or 'ssh' for an SSH private key.
+	--signing-passphrase  The passphrase of the signing key, if it is protected.
+	--patch-file     With --dry-run, write the changes to this patch file instead of printing them.
+	                 UTF-16 files are written as git binary patches, so that git apply accepts the whole file.
 	`
 }
 
@@ -0,0 +1,467 @@
+// +build !integration
+
+package files
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	gitConfig "github.com/go-git/go-git/v5/config"
+	plumbing "github.com/go-git/go-git/v5/plumbing"
+	object "github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/google/go-github/v32/github"
+	hclog "github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/inclusify/pkg/config"
+	"github.com/hashicorp/inclusify/pkg/gh"
+)
+
+func newTestUpdateRefsCommand(ui *cli.MockUi) *UpdateRefsCommand {
+	return &UpdateRefsCommand{
+		Config: &config.Config{
+			Owner:     "hashicorp",
+			Repo:      "test",
+			Base:      "master",
+			Target:    "main",
+			Token:     "token",
+			Exclusion: []string{".git/"},
+			Logger: hclog.New(&hclog.LoggerOptions{
+				Output: ui.OutputWriter,
+			}),
+		},
+		TempBranch: "update-references",
+	}
+}
+
+// writeTestFiles creates each of the files in a new temp dir, and returns the dir
+func writeTestFiles(t *testing.T, files map[string]string, mode os.FileMode) string {
+	dir, err := ioutil.TempDir("", "inclusify-files")
+	require.NoError(t, err)
+
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), mode))
+	}
+
+	return dir
+}
+
+// Test that only modified files are written, and that their mode and encoding are kept
+func Test_UpdateReferences(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+
+	utf16 := encodeText([]byte("git checkout master\r\n"), encodingUTF16LE)
+	dir := writeTestFiles(t, map[string]string{
+		"scripts/release.sh":  "#!/bin/sh\r\ngit push origin master\r\necho mastermind\r\n",
+		"docs/unchanged.md":   "Nothing to see here\n",
+		"docs/bom.md":         "\xEF\xBB\xBFmaster is the default\n",
+		"windows/checkout.ps": string(utf16),
+		"assets/logo.png":     "\x89PNG\r\n\x1a\n\x00\x00master",
+	}, 0755)
+	defer os.RemoveAll(dir)
+
+	unchanged := filepath.Join(dir, "docs", "unchanged.md")
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(unchanged, past, past))
+
+	result, err := UpdateReferences(c, dir)
+	require.NoError(t, err)
+
+	var changed []string
+	for _, change := range result.Changed {
+		changed = append(changed, change.Path)
+	}
+	assert.ElementsMatch(t, []string{"scripts/release.sh", "docs/bom.md", "windows/checkout.ps"}, changed)
+	assert.Equal(t, []SkippedFile{{Path: "assets/logo.png", Reason: SkipBinary}}, result.Skipped)
+	assert.Equal(t, 3, result.Replacements())
+
+	read, err := ioutil.ReadFile(filepath.Join(dir, "scripts", "release.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, "#!/bin/sh\r\ngit push origin main\r\necho mastermind\r\n", string(read))
+	fi, err := os.Stat(filepath.Join(dir, "scripts", "release.sh"))
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0755), fi.Mode().Perm())
+
+	read, err = ioutil.ReadFile(filepath.Join(dir, "docs", "bom.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "\xEF\xBB\xBFmain is the default\n", string(read))
+
+	read, err = ioutil.ReadFile(filepath.Join(dir, "windows", "checkout.ps"))
+	require.NoError(t, err)
+	assert.Equal(t, encodeText([]byte("git checkout main\r\n"), encodingUTF16LE), read)
+
+	fi, err = os.Stat(unchanged)
+	require.NoError(t, err)
+	assert.Equal(t, past, fi.ModTime())
+
+	output := ui.OutputWriter.String()
+	assert.Contains(t, output, "Updated the file: path=scripts/release.sh replacements=1")
+	assert.NotContains(t, output, "path=docs/unchanged.md")
+	assert.Contains(t, output, "Skipped the file: path=assets/logo.png reason=binary")
+}
+
+// Test that dry-run mode reports the changes as a diff without writing any files
+func Test_UpdateReferences_DryRun(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+	c.UI = ui
+	c.Config.DryRun = true
+
+	original := "on:\n  push:\n    branches:\n      - master\n"
+	dir := writeTestFiles(t, map[string]string{".github/workflows/ci.yml": original}, 0644)
+	defer os.RemoveAll(dir)
+
+	result, err := UpdateReferences(c, dir)
+	require.NoError(t, err)
+	require.True(t, result.FilesChanged())
+
+	read, err := ioutil.ReadFile(filepath.Join(dir, ".github", "workflows", "ci.yml"))
+	require.NoError(t, err)
+	assert.Equal(t, original, string(read))
+
+	c.Config.PatchFile = filepath.Join(dir, "changes.patch")
+	require.NoError(t, ShowDiff(c, result))
+	patch, err := ioutil.ReadFile(c.Config.PatchFile)
+	require.NoError(t, err)
+	assert.Equal(t, `diff --git a/.github/workflows/ci.yml b/.github/workflows/ci.yml
+--- a/.github/workflows/ci.yml
++++ b/.github/workflows/ci.yml
+@@ -1,4 +1,4 @@
+ on:
+   push:
+     branches:
+-      - master
++      - main
+`, string(patch))
+}
+
+// Test that only files matching the include patterns are updated
+func Test_UpdateReferences_Include(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+	c.Config.Include = append([]string{"Makefile"}, config.CIPreset...)
+
+	dir := writeTestFiles(t, map[string]string{
+		".circleci/config.yml":     "ignore: master\n",
+		".github/workflows/ci.yml": "branches: [master]\n",
+		".travis.yaml":             "branches:\n  only:\n    - master\n",
+		"Makefile":                 "BRANCH ?= master\n",
+		"README.md":                "Merge into master\n",
+		"docs/Jenkinsfile.md":      "Jenkinsfile docs for master\n",
+	}, 0644)
+	defer os.RemoveAll(dir)
+
+	result, err := UpdateReferences(c, dir)
+	require.NoError(t, err)
+
+	var changed []string
+	for _, change := range result.Changed {
+		changed = append(changed, change.Path)
+	}
+	assert.ElementsMatch(t, []string{".circleci/config.yml", ".github/workflows/ci.yml", ".travis.yaml", "Makefile"}, changed)
+}
+
+// Test that only branch filters are rewritten in CI configs in structured mode
+func Test_UpdateReferences_StructuredCI(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+	c.Config.StructuredCI = true
+
+	dir := writeTestFiles(t, map[string]string{
+		".github/workflows/ci.yml": "on:\n  push:\n    branches: [master] # master only\njobs:\n  build:\n    steps:\n      - run: echo master\n",
+		".circleci/config.yml":     "jobs: [unclosed master",
+		"docs/release.md":          "Merge into master\n",
+	}, 0644)
+	defer os.RemoveAll(dir)
+
+	result, err := UpdateReferences(c, dir)
+	require.NoError(t, err)
+	assert.Equal(t, []SkippedFile{{Path: ".circleci/config.yml", Reason: SkipInvalidCI}}, result.Skipped)
+
+	read, err := ioutil.ReadFile(filepath.Join(dir, ".github", "workflows", "ci.yml"))
+	require.NoError(t, err)
+	assert.Equal(t, "on:\n  push:\n    branches: [main] # master only\njobs:\n  build:\n    steps:\n      - run: echo master\n", string(read))
+
+	read, err = ioutil.ReadFile(filepath.Join(dir, "docs", "release.md"))
+	require.NoError(t, err)
+	assert.Equal(t, "Merge into main\n", string(read))
+}
+
+// Test that links to other repos are only rewritten if the new branch exists in them
+func Test_UpdateReferences_CheckLinks(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+	c.Config.CheckLinks = true
+	client := gh.NewMockGithubInteractor()
+	client.Repos["moved/repo"] = &github.Repository{DefaultBranch: github.String("main")}
+	client.Repos["stale/repo"] = &github.Repository{DefaultBranch: github.String("master")}
+	client.Branches["stale/repo"] = []string{"master"}
+	c.GithubClient = client
+
+	dir := writeTestFiles(t, map[string]string{
+		"README.md": `Run git checkout master
+- https://github.com/hashicorp/test/blob/master/README.md
+- https://github.com/moved/repo/blob/master/README.md
+- https://raw.githubusercontent.com/stale/repo/master/install.sh
+- https://github.com/moved/master-tools/tree/master
+`,
+	}, 0644)
+	defer os.RemoveAll(dir)
+
+	result, err := UpdateReferences(c, dir)
+	require.NoError(t, err)
+
+	read, err := ioutil.ReadFile(filepath.Join(dir, "README.md"))
+	require.NoError(t, err)
+	assert.Equal(t, `Run git checkout main
+- https://github.com/hashicorp/test/blob/main/README.md
+- https://github.com/moved/repo/blob/main/README.md
+- https://raw.githubusercontent.com/stale/repo/master/install.sh
+- https://github.com/moved/master-tools/tree/master
+`, string(read))
+
+	require.Len(t, result.Flagged, 2)
+	assert.Equal(t, FlaggedLink{
+		Path:   "README.md",
+		Line:   4,
+		URL:    "https://raw.githubusercontent.com/stale/repo/master/install.sh",
+		Reason: "branch 'main' does not exist in stale/repo",
+	}, result.Flagged[0])
+	assert.Equal(t, 5, result.Flagged[1].Line)
+
+	// Without a token, links to other repos are never rewritten
+	c.Config.Token = ""
+	c.Config.DryRun = true
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "README.md"), []byte("https://github.com/moved/repo/blob/master/README.md\n"), 0644))
+	result, err = UpdateReferences(c, dir)
+	require.NoError(t, err)
+	assert.False(t, result.FilesChanged())
+	assert.Len(t, result.Flagged, 1)
+}
+
+// Test that only the branch of a submodule is rewritten, and only if it exists in the submodule
+func Test_UpdateReferences_Gitmodules(t *testing.T) {
+	ui := cli.NewMockUi()
+	c := newTestUpdateRefsCommand(ui)
+	client := gh.NewMockGithubInteractor()
+	client.Repos["hashicorp/lib"] = &github.Repository{DefaultBranch: github.String("main")}
+	client.Repos["hashicorp/master-docs"] = &github.Repository{DefaultBranch: github.String("master")}
+	client.Branches["hashicorp/master-docs"] = []string{"master"}
+	c.GithubClient = client
+
+	dir := writeTestFiles(t, map[string]string{
+		".gitmodules": `[submodule "lib"]
+	path = lib
+	url = https://github.com/hashicorp/lib.git
+	branch = master
+[submodule "docs"]
+	path = docs
+	url = ../master-docs.git
+	branch = master
+`,
+	}, 0644)
+	defer os.RemoveAll(dir)
+
+	result, err := UpdateReferences(c, dir)
+	require.NoError(t, err)
+
+	read, err := ioutil.ReadFile(filepath.Join(dir, ".gitmodules"))
+	require.NoError(t, err)
+	assert.Equal(t, `[submodule "lib"]
+	path = lib
+	url = https://github.com/hashicorp/lib.git
+	branch = main
+[submodule "docs"]
+	path = docs
+	url = ../master-docs.git
+	branch = master
+`, string(read))
+
+	require.Len(t, result.Flagged, 2)
+	assert.Equal(t, FlaggedLink{Path: ".gitmodules", Line: 7, Reason: "'master' is not the branch of a submodule"}, result.Flagged[0])
+	assert.Equal(t, FlaggedLink{
+		Path:   ".gitmodules",
+		Line:   8,
+		URL:    "../master-docs.git",
+		Reason: "branch 'main' does not exist in hashicorp/master-docs",
+	}, result.Flagged[1])
+
+	// A submodule migrated in this run has the new branch, without asking GitHub
+	c.submodules = []submodulePull{{Owner: "hashicorp", Repo: "master-docs"}}
+	c.Config.DryRun = true
+	result, err = UpdateReferences(c, dir)
+	require.NoError(t, err)
+	require.Len(t, result.Flagged, 1)
+	assert.Equal(t, 7, result.Flagged[0].Line)
+
+	// Unless its migration failed
+	c.submodules = []submodulePull{{Owner: "hashicorp", Repo: "master-docs", Err: fmt.Errorf("failed to create branches in hashicorp/master-docs")}}
+	result, err = UpdateReferences(c, dir)
+	require.NoError(t, err)
+	require.Len(t, result.Flagged, 2)
+	assert.Equal(t, 8, result.Flagged[1].Line)
+}
+
+// newTestRemote creates a bare repo named test.git in a new temp dir, with the
+// files committed to master, and main and update-references branched off of it
+func newTestRemote(t *testing.T, files map[string]string) (dir string, base plumbing.Hash) {
+	repo, src := initTestRepo(t, files)
+	defer os.RemoveAll(src)
+	head, err := repo.Head()
+	require.NoError(t, err)
+	for _, branch := range []string{"main", "update-references"} {
+		require.NoError(t, repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName(branch), head.Hash())))
+	}
+
+	dir, err = ioutil.TempDir("", "inclusify-remote")
+	require.NoError(t, err)
+	_, err = git.PlainInit(filepath.Join(dir, "test.git"), true)
+	require.NoError(t, err)
+	_, err = repo.CreateRemote(&gitConfig.RemoteConfig{Name: "origin", URLs: []string{filepath.Join(dir, "test.git")}})
+	require.NoError(t, err)
+	require.NoError(t, repo.Push(&git.PushOptions{RefSpecs: []gitConfig.RefSpec{"refs/heads/*:refs/heads/*"}}))
+
+	return dir, head.Hash()
+}
+
+// Test that re-runs regenerate the changes on top of $target, replace the ones
+// on $tmpBranch, and update the PR that is already open
+func Test_Migrate_Rerun(t *testing.T) {
+	ui := cli.NewMockUi()
+	remote, base := newTestRemote(t, map[string]string{"Makefile": "BRANCH ?= master\n"})
+	defer os.RemoveAll(remote)
+	bare, err := git.PlainOpen(filepath.Join(remote, "test.git"))
+	require.NoError(t, err)
+
+	client := gh.NewMockGithubInteractor()
+	c := newTestUpdateRefsCommand(ui)
+	c.GithubClient = client
+	c.UI = ui
+	c.Config.RemoteURL = filepath.Join(remote, "{repo}.git")
+	c.Config.WorkspaceDir = remote
+	c.Config.Author = config.DefaultIdentity
+	c.Config.Committer = config.DefaultIdentity
+	c.Config.SingleCommit = true
+
+	for _, target := range []string{"main", "main-updated"} {
+		// $target moves on between runs, and the changes must follow it
+		if target == "main-updated" {
+			ws, err := CloneRepo(c)
+			require.NoError(t, err)
+			require.NoError(t, ioutil.WriteFile(filepath.Join(ws.Dir, "README.md"), []byte("See master\n"), 0644))
+			worktree, err := ws.Repo.Worktree()
+			require.NoError(t, err)
+			_, err = worktree.Add("README.md")
+			require.NoError(t, err)
+			base, err = worktree.Commit("Add README", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}})
+			require.NoError(t, err)
+			require.NoError(t, ws.Repo.Push(&git.PushOptions{}))
+			ws.Close()
+		}
+
+		pr, err := c.migrate()
+		require.NoError(t, err, ui.OutputWriter.String())
+		assert.Equal(t, 1, pr.GetNumber())
+		assert.Equal(t, "https://github.com/hashicorp/test/pull/1", pr.GetHTMLURL())
+
+		ref, err := bare.Reference("refs/heads/update-references", false)
+		require.NoError(t, err)
+		commit, err := bare.CommitObject(ref.Hash())
+		require.NoError(t, err)
+		assert.Equal(t, []plumbing.Hash{base}, commit.ParentHashes, target)
+	}
+
+	ref, err := bare.Reference("refs/heads/update-references", false)
+	require.NoError(t, err)
+	tip, err := bare.CommitObject(ref.Hash())
+	require.NoError(t, err)
+	file, err := tip.File("README.md")
+	require.NoError(t, err)
+	content, err := file.Contents()
+	require.NoError(t, err)
+	assert.Equal(t, "See main\n", content)
+	assert.Len(t, client.Pulls, 1)
+	assert.Contains(t, ui.OutputWriter.String(), "Updating the PR that is already open for branch")
+
+	// The changes are only pushed if $tmpBranch is still where it was when the repo was
+	// cloned, so a commit pushed to it in the meantime is never overwritten
+	ws, err := CloneRepo(c)
+	require.NoError(t, err)
+	defer ws.Close()
+	c.lease, err = remoteBranch(c.Config, ws.Repo, c.TempBranch)
+	require.NoError(t, err)
+	pushed := pushTestCommit(t, c, "update-references", "NOTES.md", "Reviewed\n")
+	result, err := UpdateReferences(c, ws.Dir)
+	require.NoError(t, err)
+	err = GitPush(c, c.TempBranch, ws.Repo, result)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), fmt.Sprintf("was updated from %s to %s", c.lease, pushed))
+	ref, err = bare.Reference("refs/heads/update-references", false)
+	require.NoError(t, err)
+	assert.Equal(t, pushed, ref.Hash())
+}
+
+// Test that without a lease, i.e. when $tmpBranch didn't exist, it's only created
+// and a branch created by someone else in the meantime is left alone
+func Test_GitPush_NoLease(t *testing.T) {
+	ui := cli.NewMockUi()
+	remote, _ := newTestRemote(t, map[string]string{"Makefile": "BRANCH ?= master\n"})
+	defer os.RemoveAll(remote)
+	bare, err := git.PlainOpen(filepath.Join(remote, "test.git"))
+	require.NoError(t, err)
+
+	c := newTestUpdateRefsCommand(ui)
+	c.Config.RemoteURL = filepath.Join(remote, "{repo}.git")
+	c.Config.WorkspaceDir = remote
+	c.Config.Author = config.DefaultIdentity
+	c.Config.Committer = config.DefaultIdentity
+	c.Config.SingleCommit = true
+	c.TempBranch = "new-references"
+
+	ws, err := CloneRepo(c)
+	require.NoError(t, err)
+	defer ws.Close()
+	pushed := pushTestCommit(t, c, "new-references", "NOTES.md", "Reviewed\n")
+	result, err := UpdateReferences(c, ws.Dir)
+	require.NoError(t, err)
+	require.Error(t, GitPush(c, c.TempBranch, ws.Repo, result))
+	ref, err := bare.Reference("refs/heads/new-references", false)
+	require.NoError(t, err)
+	assert.Equal(t, pushed, ref.Hash())
+
+	require.NoError(t, bare.Storer.RemoveReference("refs/heads/new-references"))
+	require.NoError(t, GitPush(c, c.TempBranch, ws.Repo, result))
+	ref, err = bare.Reference("refs/heads/new-references", false)
+	require.NoError(t, err)
+	head, err := ws.Repo.Head()
+	require.NoError(t, err)
+	assert.Equal(t, head.Hash(), ref.Hash())
+}
+
+// pushTestCommit commits a file on top of $target and pushes it to branch, as if
+// someone else did, and returns the commit
+func pushTestCommit(t *testing.T, c *UpdateRefsCommand, branch, name, content string) plumbing.Hash {
+	ws, err := CloneRepo(c)
+	require.NoError(t, err)
+	defer ws.Close()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(ws.Dir, name), []byte(content), 0644))
+	worktree, err := ws.Repo.Worktree()
+	require.NoError(t, err)
+	_, err = worktree.Add(name)
+	require.NoError(t, err)
+	sha, err := worktree.Commit("Add "+name, &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}})
+	require.NoError(t, err)
+	refSpec := gitConfig.RefSpec(fmt.Sprintf("+refs/heads/%s:refs/heads/%s", c.Config.Target, branch))
+	require.NoError(t, ws.Repo.Push(&git.PushOptions{RefSpecs: []gitConfig.RefSpec{refSpec}}))
+	return sha
+}
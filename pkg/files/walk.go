@@ -0,0 +1,175 @@
+package files
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	hclog "github.com/hashicorp/go-hclog"
+
+	"github.com/hashicorp/inclusify/pkg/config"
+	"github.com/hashicorp/inclusify/pkg/pathspec"
+)
+
+// walkFunc is called for every file that is not excluded. rel is the path
+// relative to the repo root, using forward slashes.
+type walkFunc func(path string, rel string, fi os.FileInfo) error
+
+// WalkRepo walks every file in the repo at dir, skipping any paths that match
+// the gitignore-style patterns in `INCLUSIFY_EXCLUSION`. If `INCLUSIFY_INCLUDE`
+// is set, only files matching those patterns are walked. Patterns are matched
+// relative to the repo root, never against the absolute path of dir.
+func WalkRepo(c *config.Config, dir string, fn walkFunc) (err error) {
+	exclusion, err := pathspec.Compile(c.Exclusion)
+	if err != nil {
+		return fmt.Errorf("failed to parse exclusions: %w", err)
+	}
+	include, err := pathspec.Compile(c.Include)
+	if err != nil {
+		return fmt.Errorf("failed to parse includes: %w", err)
+	}
+
+	return filepath.Walk(dir, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == dir {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		// Skip directories and files that should be excluded
+		if fi.IsDir() {
+			if exclusion.Prune(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if exclusion.Match(rel, false) {
+			return nil
+		}
+		if !include.Empty() && !include.Match(rel, false) {
+			return nil
+		}
+
+		return fn(path, rel, fi)
+	})
+}
+
+// processFunc handles a single file on one of the workers of WalkRepoParallel,
+// so it must be safe for concurrent use. Its result is passed to a collectFunc.
+type processFunc func(path string, rel string, fi os.FileInfo) (result interface{}, err error)
+
+// collectFunc receives the result of each file processed by WalkRepoParallel
+type collectFunc func(rel string, result interface{}) error
+
+// errStopped is returned to the walk once WalkRepoParallel gives up on an error
+var errStopped = errors.New("walk stopped")
+
+// WalkRepoParallel walks the same files as WalkRepo, but processes up to
+// `INCLUSIFY_WORKERS` of them at once. Results are collected one at a time, in
+// the order the files were walked, so the outcome never depends on how the work
+// was scheduled. The walk can only get a few files ahead of the collector, which
+// bounds how many files are held in memory. The first error stops the walk.
+func WalkRepoParallel(c *config.Config, dir string, process processFunc, collect collectFunc) (err error) {
+	workers := c.Workers
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	type outcome struct {
+		result interface{}
+		err    error
+	}
+	type job struct {
+		path string
+		rel  string
+		fi   os.FileInfo
+		done chan outcome
+	}
+
+	jobs := make(chan job)
+	pending := make(chan job, 2*workers)
+	stop := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				result, err := process(j.path, j.rel, j.fi)
+				j.done <- outcome{result: result, err: err}
+			}
+		}()
+	}
+
+	walked := make(chan error, 1)
+	go func() {
+		defer close(pending)
+		defer close(jobs)
+		walked <- WalkRepo(c, dir, func(path string, rel string, fi os.FileInfo) error {
+			j := job{path: path, rel: rel, fi: fi, done: make(chan outcome, 1)}
+			// Queue the job for the collector before any worker can pick it up, so that
+			// the collector always waits on a job that is already being processed
+			select {
+			case pending <- j:
+			case <-stop:
+				return errStopped
+			}
+			select {
+			case jobs <- j:
+			case <-stop:
+				return errStopped
+			}
+			return nil
+		})
+	}()
+
+	for j := range pending {
+		o := <-j.done
+		err = o.err
+		if err == nil {
+			err = collect(j.rel, o.result)
+		}
+		if err != nil {
+			close(stop)
+			break
+		}
+	}
+	// Let the walk and the workers wind down, without collecting anything else
+	for range pending {
+	}
+	wg.Wait()
+
+	if walkErr := <-walked; err == nil && walkErr != errStopped {
+		err = walkErr
+	}
+
+	return err
+}
+
+// logThroughput logs how many files and bytes were processed, and how fast
+func logThroughput(logger hclog.Logger, files int, size int64, start time.Time) {
+	elapsed := time.Since(start)
+	seconds := elapsed.Seconds()
+	if seconds <= 0 {
+		seconds = 1e-9
+	}
+	logger.Info("Processed files",
+		"files", files,
+		"bytes", size,
+		"duration", elapsed.Round(time.Millisecond),
+		"filesPerSecond", fmt.Sprintf("%.0f", float64(files)/seconds),
+		"mbPerSecond", fmt.Sprintf("%.1f", float64(size)/(1<<20)/seconds),
+	)
+}
@@ -0,0 +1,62 @@
+// +build !integration
+
+package files
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"testing"
+
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that results are collected in walk order, however many workers there are
+func Test_WalkRepoParallel(t *testing.T) {
+	files := map[string]string{}
+	var want []string
+	for i := 0; i < 100; i++ {
+		name := fmt.Sprintf("dir%d/file%02d.txt", i%3, i)
+		files[name] = name
+		want = append(want, name)
+	}
+	sort.Strings(want)
+	dir := writeTestFiles(t, files, 0644)
+	defer os.RemoveAll(dir)
+
+	for _, workers := range []int{1, 4, 16} {
+		c := newTestUpdateRefsCommand(cli.NewMockUi()).Config
+		c.Workers = workers
+
+		var got []string
+		err := WalkRepoParallel(c, dir, func(path string, rel string, fi os.FileInfo) (interface{}, error) {
+			return rel, nil
+		}, func(rel string, result interface{}) error {
+			assert.Equal(t, rel, result)
+			got = append(got, rel)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, want, got, "workers=%d", workers)
+	}
+
+	// The first error stops the walk
+	c := newTestUpdateRefsCommand(cli.NewMockUi()).Config
+	c.Workers = 4
+	failed := errors.New("failed")
+	collected := 0
+	err := WalkRepoParallel(c, dir, func(path string, rel string, fi os.FileInfo) (interface{}, error) {
+		if rel == want[10] {
+			return nil, failed
+		}
+		return rel, nil
+	}, func(rel string, result interface{}) error {
+		collected++
+		return nil
+	})
+	assert.Equal(t, failed, err)
+	assert.Equal(t, 10, collected)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 
 	github "github.com/google/go-github/v32/github"
 )
@@ -22,7 +23,16 @@ type MockGithubInteractor struct {
 
 	MasterRef string
 
+	// Repos and Branches are other repos, keyed by 'owner/repo', and the
+	// branches that exist in them
+	Repos    map[string]*github.Repository
+	Branches map[string][]string
+
 	CreatedReferences []*github.Reference
+
+	// Pulls are the PRs opened with the mock, numbered from 1 in the order they
+	// were opened
+	Pulls []*github.PullRequest
 }
 
 // NewMockGithubInteractor is a constructor for MockGithubInteractor. It sets
@@ -30,6 +40,8 @@ type MockGithubInteractor struct {
 func NewMockGithubInteractor() *MockGithubInteractor {
 	m := &MockGithubInteractor{
 		MasterRef: masterRef,
+		Repos:     map[string]*github.Repository{},
+		Branches:  map[string][]string{},
 	}
 
 	m.Git = &MockGithubGitInteractor{parent: m}
@@ -70,19 +82,34 @@ type MockGithubPRsInteractor struct {
 	parent *MockGithubInteractor
 }
 
-// GetRef validates it is called for hashicorp/test@master, then returns a
-// hardcoded SHA.
+// GetRef validates it is called for hashicorp/test, then returns a hardcoded SHA
+// for master, or a Reference created with the mock.
 func (m *MockGithubGitInteractor) GetRef(
 	ctx context.Context, owner string, repo string, ref string,
 ) (*github.Reference, *github.Response, error) {
+	// Other repos only have the branches they were set up with
+	if branches, ok := m.parent.Branches[owner+"/"+repo]; ok {
+		for _, branch := range branches {
+			if ref == "refs/heads/"+branch {
+				return &github.Reference{Ref: github.String(ref), Object: &github.GitObject{SHA: github.String(m.parent.MasterRef)}}, nil, nil
+			}
+		}
+		return nil, &github.Response{Response: &http.Response{StatusCode: http.StatusNotFound}}, errors.New("404 Not Found")
+	}
+
 	// Validate this request was for hashicorp/test
 	if owner != "hashicorp" && repo != "test" {
 		return nil, nil, errors.New("must be called for hashicorp/test")
 	}
 
-	// We can only return the ref for master
+	// Besides master, only the References created with the mock exist
 	if ref != "refs/heads/master" {
-		return nil, nil, fmt.Errorf("must be called for refs/heads/master but got %s", ref)
+		for _, created := range m.parent.CreatedReferences {
+			if created.GetRef() == ref {
+				return created, nil, nil
+			}
+		}
+		return nil, &github.Response{Response: &http.Response{StatusCode: http.StatusNotFound}}, errors.New("404 Not Found")
 	}
 
 	// Let's start simple, always return a nicely formatted Ref, and no error:
@@ -95,7 +122,7 @@ func (m *MockGithubGitInteractor) GetRef(
 }
 
 // CreateRef checks it was called for hashicorp/test, then records the requested
-// Reference.
+// Reference. Like GitHub, it fails with a 422 if the Reference was already created.
 func (m *MockGithubGitInteractor) CreateRef(
 	ctx context.Context, owner string, repo string, ref *github.Reference,
 ) (*github.Reference, *github.Response, error) {
@@ -104,6 +131,13 @@ func (m *MockGithubGitInteractor) CreateRef(
 		return nil, nil, errors.New("must be called for hashicorp/test")
 	}
 
+	for _, created := range m.parent.CreatedReferences {
+		if created.GetRef() == ref.GetRef() {
+			res := &http.Response{StatusCode: http.StatusUnprocessableEntity}
+			return nil, &github.Response{Response: res}, &github.ErrorResponse{Response: res, Message: "Reference already exists"}
+		}
+	}
+
 	m.parent.CreatedReferences = append(
 		m.parent.CreatedReferences, ref,
 	)
@@ -117,6 +151,16 @@ func (m *MockGithubGitInteractor) DeleteRef(
 	return nil, nil
 }
 
+// Get returns one of the repos the mock was set up with, or a 404 error
+func (m *MockGithubRepoInteractor) Get(
+	ctx context.Context, owner string, repo string,
+) (*github.Repository, *github.Response, error) {
+	if r, ok := m.parent.Repos[owner+"/"+repo]; ok {
+		return r, nil, nil
+	}
+	return nil, &github.Response{Response: &http.Response{StatusCode: http.StatusNotFound}}, errors.New("404 Not Found")
+}
+
 // Create .............................
 func (m *MockGithubRepoInteractor) Create(
 	ctx context.Context, owner string, repository *github.Repository,
@@ -161,25 +205,66 @@ func (m *MockGithubRepoInteractor) UpdateBranchProtection(
 
 // PR stuff
 
-// Edit .............................
+// Edit updates the title, body and state of a PR opened with the mock
 func (m *MockGithubPRsInteractor) Edit(
 	ctx context.Context, owner string, repo string, number int, pull *github.PullRequest,
 ) (*github.PullRequest, *github.Response, error) {
-	return nil, nil, nil
+	if number < 1 || number > len(m.parent.Pulls) {
+		return nil, &github.Response{Response: &http.Response{StatusCode: http.StatusNotFound}}, errors.New("404 Not Found")
+	}
+
+	existing := m.parent.Pulls[number-1]
+	if pull.Title != nil {
+		existing.Title = pull.Title
+	}
+	if pull.Body != nil {
+		existing.Body = pull.Body
+	}
+	if pull.State != nil {
+		existing.State = pull.State
+	}
+
+	return existing, nil, nil
 }
 
-// List .............................
+// List returns the PRs opened with the mock that match the head, base and state in opts
 func (m *MockGithubPRsInteractor) List(
 	ctx context.Context, owner string, repo string, opts *github.PullRequestListOptions,
 ) ([]*github.PullRequest, *github.Response, error) {
-	return nil, nil, nil
+	var pulls []*github.PullRequest
+	for _, pull := range m.parent.Pulls {
+		switch {
+		case opts == nil:
+		case opts.Head != "" && opts.Head != pull.GetHead().GetLabel():
+			continue
+		case opts.Base != "" && opts.Base != pull.GetBase().GetRef():
+			continue
+		case opts.State != "" && opts.State != "all" && opts.State != pull.GetState():
+			continue
+		}
+		pulls = append(pulls, pull)
+	}
+
+	return pulls, nil, nil
 }
 
-// Create .............................
+// Create records a new open PR, and returns it
 func (m *MockGithubPRsInteractor) Create(
 	ctx context.Context, owner string, repo string, pull *github.NewPullRequest,
 ) (*github.PullRequest, *github.Response, error) {
-	return nil, nil, nil
+	number := len(m.parent.Pulls) + 1
+	created := &github.PullRequest{
+		Number:  github.Int(number),
+		HTMLURL: github.String(fmt.Sprintf("https://github.com/%s/%s/pull/%d", owner, repo, number)),
+		State:   github.String("open"),
+		Title:   pull.Title,
+		Body:    pull.Body,
+		Head:    &github.PullRequestBranch{Ref: pull.Head, Label: github.String(owner + ":" + pull.GetHead())},
+		Base:    &github.PullRequestBranch{Ref: pull.Base},
+	}
+	m.parent.Pulls = append(m.parent.Pulls, created)
+
+	return created, nil, nil
 }
 
 // Merge .............................
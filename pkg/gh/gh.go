@@ -2,7 +2,14 @@ package gh
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/google/go-github/v32/github"
 	"golang.org/x/oauth2"
@@ -36,6 +43,7 @@ type GithubPRInteractor interface {
 // GithubRepoInteractor is a more specific interface that represents a RepositoriesService
 // in GitHub. This can also be real or fake.
 type GithubRepoInteractor interface {
+	Get(ctx context.Context, owner string, repo string) (*github.Repository, *github.Response, error)
 	Create(ctx context.Context, owner string, repository *github.Repository) (*github.Repository, *github.Response, error)
 	Edit(ctx context.Context, owner string, repo string, repository *github.Repository) (*github.Repository, *github.Response, error)
 	RemoveBranchProtection(ctx context.Context, owner string, repo string, branch string) (*github.Response, error)
@@ -68,16 +76,50 @@ func (b *BaseGithubInteractor) GetPRs() GithubPRInteractor {
 	return b.github.PullRequests
 }
 
+// ClientOptions configure the GitHub client for a GitHub Enterprise Server, or
+// for a network that needs a proxy or a custom CA
+type ClientOptions struct {
+	// BaseURL is the API URL of a GitHub Enterprise Server, e.g.
+	// 'https://github.example.com/api/v3/'. github.com is used if it's empty.
+	BaseURL string
+	// UploadURL is the uploads API URL of a GitHub Enterprise Server. It defaults
+	// to the one on the host of BaseURL.
+	UploadURL string
+	// HTTPClient makes the requests before they are authenticated, e.g. one from
+	// NewHTTPClient. http.DefaultClient is used if it's nil.
+	HTTPClient *http.Client
+}
+
 // NewBaseGithubInteractor is a constructor for baseGithubInteractor.
 func NewBaseGithubInteractor(token string) (*BaseGithubInteractor, error) {
+	return NewGithubInteractor(token, ClientOptions{})
+}
+
+// NewGithubInteractor is a constructor for baseGithubInteractor, which calls
+// github.com or the GitHub Enterprise Server set in opts.
+func NewGithubInteractor(token string, opts ClientOptions) (*BaseGithubInteractor, error) {
 	if token == "" {
 		return nil, errors.New("cannot create GitHub Client with empty token")
 	}
 
 	ctx := context.Background()
+	if opts.HTTPClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, opts.HTTPClient)
+	}
 	oauthToken := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
 	oathClient := oauth2.NewClient(ctx, oauthToken)
 	client := github.NewClient(oathClient)
+	if opts.BaseURL != "" {
+		uploadURL := opts.UploadURL
+		if uploadURL == "" {
+			uploadURL = strings.TrimSuffix(strings.TrimSuffix(opts.BaseURL, "/"), "/api/v3")
+		}
+		var err error
+		client, err = github.NewEnterpriseClient(opts.BaseURL, uploadURL, oathClient)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create GitHub Enterprise client for %s: %w", opts.BaseURL, err)
+		}
+	}
 
 	return &BaseGithubInteractor{
 		github: client,
@@ -85,3 +127,35 @@ func NewBaseGithubInteractor(token string) (*BaseGithubInteractor, error) {
 		pr:     client.PullRequests,
 	}, nil
 }
+
+// NewHTTPClient returns an HTTP client that trusts the certificates in the PEM
+// file at caBundle, in addition to the system's, and sends every request through
+// the proxy URL. Without a proxy, the HTTPS_PROXY and NO_PROXY env vars are used.
+func NewHTTPClient(caBundle, proxy string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse proxy URL %s: %w", proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if caBundle != "" {
+		pem, err := ioutil.ReadFile(caBundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("failed to parse CA bundle %s: no PEM certificates found", caBundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,55 @@
+// +build !integration
+
+package gh
+
+import (
+	"context"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that the client calls the API of a GitHub Enterprise Server, and trusts its CA
+func Test_NewGithubInteractor_Enterprise(t *testing.T) {
+	var path, auth string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		w.Write([]byte(`{"default_branch": "main"}`))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "gh")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	caBundle := filepath.Join(dir, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	require.NoError(t, ioutil.WriteFile(caBundle, cert, 0644))
+
+	httpClient, err := NewHTTPClient(caBundle, "")
+	require.NoError(t, err)
+	client, err := NewGithubInteractor("token", ClientOptions{BaseURL: server.URL + "/api/v3/", HTTPClient: httpClient})
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/api/uploads/", client.github.UploadURL.String())
+
+	repo, _, err := client.GetRepo().Get(context.Background(), "hashicorp", "test")
+	require.NoError(t, err)
+	assert.Equal(t, "main", repo.GetDefaultBranch())
+	assert.Equal(t, "/api/v3/repos/hashicorp/test", path)
+	assert.Equal(t, "Bearer token", auth)
+
+	// Without the CA bundle, the server's certificate is not trusted
+	client, err = NewGithubInteractor("token", ClientOptions{BaseURL: server.URL + "/api/v3/"})
+	require.NoError(t, err)
+	_, _, err = client.GetRepo().Get(context.Background(), "hashicorp", "test")
+	assert.Error(t, err)
+
+	_, err = NewHTTPClient(filepath.Join(dir, "missing.pem"), "")
+	assert.Error(t, err)
+}
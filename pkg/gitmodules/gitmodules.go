@@ -0,0 +1,123 @@
+package gitmodules
+
+import (
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/hashicorp/inclusify/pkg/remote"
+)
+
+// Submodule is a single entry in a .gitmodules file. BranchStart and BranchEnd are
+// the byte offsets of the branch value, or -1 if the submodule doesn't track a branch.
+type Submodule struct {
+	Name        string
+	Path        string
+	URL         string
+	Branch      string
+	BranchStart int
+	BranchEnd   int
+}
+
+var (
+	sectionHeader = regexp.MustCompile(`^\s*\[\s*submodule\s+"([^"]*)"\s*\]`)
+	keyValue      = regexp.MustCompile(`^\s*([A-Za-z][\w-]*)\s*=\s*`)
+)
+
+// Parse returns the submodules in the contents of a .gitmodules file, in the
+// order they appear. Lines that can't be parsed are ignored, as git does.
+func Parse(content []byte) []Submodule {
+	var submodules []Submodule
+	var current *Submodule
+	offset := 0
+	for _, line := range bytes.SplitAfter(content, []byte("\n")) {
+		lineStart := offset
+		offset += len(line)
+		line = bytes.TrimRight(line, "\r\n")
+
+		if m := sectionHeader.FindSubmatch(line); m != nil {
+			submodules = append(submodules, Submodule{Name: string(m[1]), BranchStart: -1, BranchEnd: -1})
+			current = &submodules[len(submodules)-1]
+			continue
+		}
+		if bytes.HasPrefix(bytes.TrimSpace(line), []byte("[")) {
+			current = nil
+			continue
+		}
+		m := keyValue.FindSubmatchIndex(line)
+		if current == nil || m == nil {
+			continue
+		}
+
+		start, end := valueRange(line, m[1])
+		value := string(line[start:end])
+		switch strings.ToLower(string(line[m[2]:m[3]])) {
+		case "path":
+			current.Path = value
+		case "url":
+			current.URL = value
+		case "branch":
+			current.Branch = value
+			current.BranchStart = lineStart + start
+			current.BranchEnd = lineStart + end
+		}
+	}
+
+	return submodules
+}
+
+// valueRange returns the [start, end) offsets of the value in line that begins
+// at start, without any quotes, trailing comment or whitespace
+func valueRange(line []byte, start int) (int, int) {
+	end := len(line)
+	if start < end && line[start] == '"' {
+		if i := bytes.IndexByte(line[start+1:], '"'); i >= 0 {
+			return start + 1, start + 1 + i
+		}
+	}
+	if i := bytes.IndexAny(line[start:], "#;"); i >= 0 {
+		end = start + i
+	}
+	for end > start && (line[end-1] == ' ' || line[end-1] == '\t') {
+		end--
+	}
+	return start, end
+}
+
+// hostURLs caches the pattern of the remote URLs of each host, keyed by host
+var hostURLs sync.Map
+
+// hostURL returns the pattern of the HTTPS and SSH remote URLs of repos on host
+func hostURL(host string) *regexp.Regexp {
+	if cached, ok := hostURLs.Load(host); ok {
+		return cached.(*regexp.Regexp)
+	}
+	compiled := regexp.MustCompile(`^(?:https?://|ssh://git@|git://|git@)(?:www\.)?` + regexp.QuoteMeta(host) + `[:/]([\w.-]+)/([\w.-]+?)(?:\.git)?/?$`)
+	hostURLs.Store(host, compiled)
+	return compiled
+}
+
+// RepoOnHost returns the owner and name of the repo on host a submodule URL
+// points at, e.g. on a GitHub Enterprise Server. An empty host is github.com.
+// Relative URLs, e.g. '../other.git', are resolved against the parent repo.
+func RepoOnHost(url, host, parentOwner, parentRepo string) (owner, repo string, ok bool) {
+	if strings.HasPrefix(url, "./") || strings.HasPrefix(url, "../") {
+		resolved := path.Join(parentOwner, parentRepo, url)
+		parts := strings.Split(resolved, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[0] == ".." {
+			return "", "", false
+		}
+		return parts[0], strings.TrimSuffix(parts[1], ".git"), true
+	}
+
+	if host == "" {
+		host = remote.DefaultHost
+	}
+	m := hostURL(host).FindStringSubmatch(url)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1], m[2], true
+}
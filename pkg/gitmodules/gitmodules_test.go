@@ -0,0 +1,73 @@
+// +build !integration
+
+package gitmodules
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/inclusify/pkg/remote"
+)
+
+// Test that submodules are parsed along with the location of their branch
+func Test_Parse(t *testing.T) {
+	content := []byte(`[submodule "docs"]
+	path = docs
+	url = https://github.com/hashicorp/docs.git
+	branch = master ; tracked by CI
+[submodule "vendor/lib"]
+	path = vendor/lib
+	url = git@github.com:other/lib.git
+	branch = "master"
+[core]
+	branch = ignored
+`)
+
+	submodules := Parse(content)
+	require.Len(t, submodules, 2)
+
+	assert.Equal(t, "docs", submodules[0].Name)
+	assert.Equal(t, "docs", submodules[0].Path)
+	assert.Equal(t, "https://github.com/hashicorp/docs.git", submodules[0].URL)
+	assert.Equal(t, "master", submodules[0].Branch)
+	assert.Equal(t, "master", string(content[submodules[0].BranchStart:submodules[0].BranchEnd]))
+
+	assert.Equal(t, "master", submodules[1].Branch)
+	assert.Equal(t, "master", string(content[submodules[1].BranchStart:submodules[1].BranchEnd]))
+
+	assert.Equal(t, -1, Parse([]byte("[submodule \"a\"]\n\tpath = a\n"))[0].BranchStart)
+}
+
+// Test that submodule URLs are resolved to GitHub repos
+func Test_RepoOnHost_GitHub(t *testing.T) {
+	cases := map[string][2]string{
+		"https://github.com/hashicorp/docs.git": {"hashicorp", "docs"},
+		"https://github.com/hashicorp/docs":     {"hashicorp", "docs"},
+		"git@github.com:other/lib.git":          {"other", "lib"},
+		"ssh://git@github.com/other/lib":        {"other", "lib"},
+		"../sibling.git":                        {"hashicorp", "sibling"},
+		"../../other/lib.git":                   {"other", "lib"},
+	}
+	for url, want := range cases {
+		owner, repo, ok := RepoOnHost(url, remote.DefaultHost, "hashicorp", "parent")
+		require.True(t, ok, url)
+		assert.Equal(t, want, [2]string{owner, repo}, url)
+	}
+
+	for _, url := range []string{"https://gitlab.com/other/lib.git", "./nested", "../../../escape.git"} {
+		_, _, ok := RepoOnHost(url, remote.DefaultHost, "hashicorp", "parent")
+		assert.False(t, ok, url)
+	}
+}
+
+// Test that submodules are resolved on the host of a GitHub Enterprise Server
+func Test_RepoOnHost(t *testing.T) {
+	owner, repo, ok := RepoOnHost("git@github.example.com:other/lib.git", "github.example.com", "hashicorp", "parent")
+	require.True(t, ok)
+	assert.Equal(t, [2]string{"other", "lib"}, [2]string{owner, repo})
+
+	_, _, ok = RepoOnHost("https://github.com/other/lib.git", "github.example.com", "hashicorp", "parent")
+	assert.False(t, ok)
+}
@@ -0,0 +1,209 @@
+package links
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/inclusify/pkg/gh"
+	"github.com/hashicorp/inclusify/pkg/remote"
+)
+
+// Link is a URL that points at a ref in a GitHub repo, e.g.
+// 'https://github.com/owner/repo/blob/master/README.md'. Start and End are the
+// byte offsets of the whole URL, and RefStart and RefEnd are those of the ref.
+type Link struct {
+	Start    int
+	End      int
+	Owner    string
+	Repo     string
+	Ref      string
+	RefStart int
+	RefEnd   int
+}
+
+// URL returns the text of the link in content
+func (l Link) URL(content []byte) string {
+	return string(content[l.Start:l.End])
+}
+
+// Contains returns true if [start, end) lies within the link
+func (l Link) Contains(start, end int) bool {
+	return l.Start <= start && end <= l.End
+}
+
+// InRef returns true if [start, end) lies within the ref of the link
+func (l Link) InRef(start, end int) bool {
+	return l.RefStart <= start && end <= l.RefEnd
+}
+
+// segment matches a single path segment, which is all we support for refs
+const segment = `[^\s/?#"'<>()\[\]{}` + "`" + `]+`
+
+// hostStart makes sure a link starts at its host, or at its scheme, so that
+// look-alike hosts such as 'notgithub.com' never match. Go's regexp has no
+// lookbehind, so it matches the character before the link instead.
+const hostStart = `(?:^|[^\w.-])`
+
+// hostPatterns caches the patterns of each host, keyed by host
+var hostPatterns sync.Map
+
+// patterns returns the patterns that match the kinds of links on host that
+// name a ref. Each has submatches for the whole link, the owner, the repo and
+// the ref, in that order. Raw files are on raw.githubusercontent.com for github.com, and on the
+// raw subdomain of a GitHub Enterprise Server.
+func patterns(host string) []*regexp.Regexp {
+	if cached, ok := hostPatterns.Load(host); ok {
+		return cached.([]*regexp.Regexp)
+	}
+
+	quoted, raw := regexp.QuoteMeta(host), `raw\.githubusercontent\.com`
+	if host != remote.DefaultHost {
+		raw = `raw\.` + quoted
+	}
+	compiled := []*regexp.Regexp{
+		regexp.MustCompile(`(?i)` + hostStart + `((?:https?://)?(?:www\.)?` + quoted + `/([\w.-]+)/([\w.-]+)/(?:blob|tree|raw|blame|edit|commits)/(` + segment + `))`),
+		regexp.MustCompile(`(?i)` + hostStart + `((?:https?://)?(?:www\.)?` + quoted + `/([\w.-]+)/([\w.-]+)/archive/(?:refs/heads/)?(` + segment + `?)(?:\.zip|\.tar\.gz))`),
+		regexp.MustCompile(`(?i)` + hostStart + `((?:https?://)?` + raw + `/([\w.-]+)/([\w.-]+)/(` + segment + `))`),
+	}
+	hostPatterns.Store(host, compiled)
+
+	return compiled
+}
+
+// FindOnHost returns every link to a ref in a repo on host in content, e.g. a
+// GitHub Enterprise Server, ordered by offset. An empty host is github.com.
+func FindOnHost(content []byte, host string) []Link {
+	if host == "" {
+		host = remote.DefaultHost
+	}
+	var links []Link
+	for _, p := range patterns(host) {
+		for _, m := range p.FindAllSubmatchIndex(content, -1) {
+			end := m[3]
+			for end < len(content) && !isURLEnd(content[end]) {
+				end++
+			}
+			links = append(links, Link{
+				Start:    m[2],
+				End:      end,
+				Owner:    string(content[m[4]:m[5]]),
+				Repo:     strings.TrimSuffix(string(content[m[6]:m[7]]), ".git"),
+				Ref:      string(content[m[8]:m[9]]),
+				RefStart: m[8],
+				RefEnd:   m[9],
+			})
+		}
+	}
+
+	// The patterns never overlap, so ordering by start is enough
+	sort.Slice(links, func(i, j int) bool { return links[i].Start < links[j].Start })
+
+	return links
+}
+
+func isURLEnd(b byte) bool {
+	return strings.IndexByte(" \t\r\n\"'<>()[]{}`", b) >= 0
+}
+
+// Resolver checks whether refs exist in other repos through the GitHub API.
+// Results are cached, so each repo and ref is only looked up once. It is safe
+// for concurrent use, and lookups of different repos and refs run concurrently.
+type Resolver struct {
+	client gh.GithubInteractor
+	// mu guards the caches, but is never held while calling the API
+	mu       sync.Mutex
+	defaults map[string]*lookup
+	refs     map[string]*lookup
+}
+
+// lookup is the result of an API call. done is closed once it's set, so that
+// concurrent callers for the same repo or ref wait for the first call instead
+// of making their own.
+type lookup struct {
+	done   chan struct{}
+	branch string
+	exists bool
+	err    error
+}
+
+// NewResolver is a constructor for Resolver
+func NewResolver(client gh.GithubInteractor) *Resolver {
+	return &Resolver{
+		client:   client,
+		defaults: map[string]*lookup{},
+		refs:     map[string]*lookup{},
+	}
+}
+
+// BranchExists returns true if branch is the default branch of owner/repo,
+// or any other branch in it
+func (r *Resolver) BranchExists(owner, repo, branch string) (exists bool, err error) {
+	key := strings.ToLower(owner + "/" + repo)
+	repository := r.once(r.defaults, key, func(l *lookup) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		found, _, err := r.client.GetRepo().Get(ctx, owner, repo)
+		if err != nil {
+			l.err = fmt.Errorf("failed to retrieve repo %s/%s: %w", owner, repo, err)
+			return
+		}
+		l.branch = found.GetDefaultBranch()
+	})
+	if repository.err != nil {
+		return false, repository.err
+	}
+	if repository.branch == branch {
+		return true, nil
+	}
+
+	ref := r.once(r.refs, key+"@"+branch, func(l *lookup) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		ref := fmt.Sprintf("refs/heads/%s", branch)
+		_, res, err := r.client.GetGit().GetRef(ctx, owner, repo, ref)
+		// GitHub lists the refs that start with the name when there's no exact match,
+		// which fails to decode as a single ref
+		missing := res != nil && (res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusOK)
+		if err != nil && !missing {
+			l.err = fmt.Errorf("failed to retrieve ref %s in %s/%s: %w", ref, owner, repo, err)
+			return
+		}
+		l.exists = err == nil
+	})
+
+	return ref.exists, ref.err
+}
+
+// once returns the lookup for key in cache, calling fetch to fill it in if no
+// other caller has. Failed lookups are dropped from the cache once the callers
+// waiting for them are done, so that later calls retry.
+func (r *Resolver) once(cache map[string]*lookup, key string, fetch func(l *lookup)) *lookup {
+	r.mu.Lock()
+	l, ok := cache[key]
+	if !ok {
+		l = &lookup{done: make(chan struct{})}
+		cache[key] = l
+	}
+	r.mu.Unlock()
+
+	if ok {
+		<-l.done
+		return l
+	}
+
+	fetch(l)
+	if l.err != nil {
+		r.mu.Lock()
+		delete(cache, key)
+		r.mu.Unlock()
+	}
+	close(l.done)
+
+	return l
+}
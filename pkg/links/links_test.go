@@ -0,0 +1,146 @@
+// +build !integration
+
+package links
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v32/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/inclusify/pkg/gh"
+	"github.com/hashicorp/inclusify/pkg/remote"
+)
+
+// Test that links to refs are found, along with the location of their ref
+func Test_FindOnHost_GitHub(t *testing.T) {
+	content := []byte(`See [the docs](https://github.com/other/repo/blob/master/docs/README.md).
+curl -O https://raw.githubusercontent.com/other/tool.go/master/install.sh
+go get github.com/other/repo
+wget "https://github.com/Other/Repo/archive/master.tar.gz"
+`)
+
+	found := FindOnHost(content, remote.DefaultHost)
+	require.Len(t, found, 3)
+
+	assert.Equal(t, "https://github.com/other/repo/blob/master/docs/README.md", found[0].URL(content))
+	assert.Equal(t, "other", found[0].Owner)
+	assert.Equal(t, "repo", found[0].Repo)
+	assert.Equal(t, "master", found[0].Ref)
+	assert.Equal(t, "master", string(content[found[0].RefStart:found[0].RefEnd]))
+
+	assert.Equal(t, "https://raw.githubusercontent.com/other/tool.go/master/install.sh", found[1].URL(content))
+	assert.Equal(t, "tool.go", found[1].Repo)
+
+	assert.Equal(t, "https://github.com/Other/Repo/archive/master.tar.gz", found[2].URL(content))
+	assert.Equal(t, "master", found[2].Ref)
+}
+
+// Test that links on look-alike hosts are never found
+func Test_FindOnHost_LookAlike(t *testing.T) {
+	content := []byte(`https://notgithub.com/other/repo/blob/master/README.md
+notgithub.com/other/repo/tree/master
+https://mygithub.com.evil/other/repo/blob/master/README.md
+https://gist.github.com/other/repo/raw/master/install.sh
+https://raw.githubusercontent.com.evil/other/repo/master/install.sh
+(github.com/other/repo/blob/master/README.md)
+`)
+
+	found := FindOnHost(content, remote.DefaultHost)
+	require.Len(t, found, 1)
+	assert.Equal(t, "github.com/other/repo/blob/master/README.md", found[0].URL(content))
+}
+
+// Test that links on a GitHub Enterprise Server are found instead of github.com's
+func Test_FindOnHost(t *testing.T) {
+	content := []byte(`https://github.example.com/other/repo/tree/master/docs
+https://raw.github.example.com/other/repo/master/install.sh
+https://github.com/other/repo/blob/master/README.md
+`)
+
+	found := FindOnHost(content, "github.example.com")
+	require.Len(t, found, 2)
+	assert.Equal(t, "https://github.example.com/other/repo/tree/master/docs", found[0].URL(content))
+	assert.Equal(t, "https://raw.github.example.com/other/repo/master/install.sh", found[1].URL(content))
+	assert.Equal(t, "master", found[1].Ref)
+}
+
+// Test that branches are looked up through the default branch, then the refs of the repo
+func Test_Resolver_BranchExists(t *testing.T) {
+	client := gh.NewMockGithubInteractor()
+	client.Repos["other/repo"] = &github.Repository{DefaultBranch: github.String("trunk")}
+	client.Branches["other/repo"] = []string{"main"}
+	r := NewResolver(client)
+
+	for branch, want := range map[string]bool{"trunk": true, "main": true, "develop": false} {
+		exists, err := r.BranchExists("other", "repo", branch)
+		require.NoError(t, err)
+		assert.Equal(t, want, exists, branch)
+	}
+
+	_, err := r.BranchExists("other", "missing", "main")
+	assert.Error(t, err)
+}
+
+// blockingRepos holds Get for owner/repo until release is closed, and counts the calls
+type blockingRepos struct {
+	gh.GithubRepoInteractor
+	blocked string
+	started chan struct{}
+	release chan struct{}
+	calls   int32
+}
+
+func (b *blockingRepos) Get(ctx context.Context, owner, repo string) (*github.Repository, *github.Response, error) {
+	if owner+"/"+repo == b.blocked {
+		atomic.AddInt32(&b.calls, 1)
+		b.started <- struct{}{}
+		<-b.release
+	}
+	return b.GithubRepoInteractor.Get(ctx, owner, repo)
+}
+
+// Test that a slow lookup doesn't hold up lookups of other repos, and that
+// concurrent lookups of the same repo share one API call
+func Test_Resolver_Concurrent(t *testing.T) {
+	client := gh.NewMockGithubInteractor()
+	client.Repos["slow/repo"] = &github.Repository{DefaultBranch: github.String("main")}
+	client.Repos["other/repo"] = &github.Repository{DefaultBranch: github.String("trunk")}
+	repos := &blockingRepos{GithubRepoInteractor: client.Repo, blocked: "slow/repo", started: make(chan struct{}, 2), release: make(chan struct{})}
+	client.Repo = repos
+	r := NewResolver(client)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			exists, err := r.BranchExists("slow", "repo", "main")
+			assert.NoError(t, err)
+			assert.True(t, exists)
+		}()
+	}
+	<-repos.started
+
+	done := make(chan struct{})
+	go func() {
+		exists, err := r.BranchExists("other", "repo", "trunk")
+		assert.NoError(t, err)
+		assert.True(t, exists)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lookup of other/repo waited for slow/repo")
+	}
+
+	close(repos.release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&repos.calls))
+}
@@ -0,0 +1,85 @@
+package matcher
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// casing is the case pattern of a word
+type casing int
+
+const (
+	caseMixed casing = iota
+	caseLower
+	caseUpper
+	caseTitle
+)
+
+// PreserveCase returns the replacement for text, which matched from while ignoring
+// case, following the case pattern of text. A lowercase, UPPERCASE or Titlecase
+// match gets the same case of replacement, and phrases are handled word by word,
+// e.g. 'Sanity Check' becomes 'Confidence Check'. If text is exactly from, or its
+// case can't be mapped onto the replacement, the replacement is used as-is.
+func PreserveCase(text, from, to string) string {
+	if text == from {
+		return to
+	}
+	if c := caseOf(text); c != caseMixed {
+		return applyCase(c, to)
+	}
+
+	// Map the case of each word onto the same word of the replacement
+	textWords, toWords := strings.Fields(text), strings.Fields(to)
+	if len(textWords) < 2 || len(textWords) != len(toWords) {
+		return to
+	}
+	for i, w := range textWords {
+		if c := caseOf(w); c != caseMixed {
+			toWords[i] = applyCase(c, toWords[i])
+		}
+	}
+	return strings.Join(toWords, " ")
+}
+
+// caseOf returns the case pattern of the letters in s
+func caseOf(s string) casing {
+	var lower, upper int
+	firstUpper := false
+	for i, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower++
+		case unicode.IsUpper(r):
+			upper++
+			if i == 0 {
+				firstUpper = true
+			}
+		}
+	}
+
+	switch {
+	case lower+upper == 0:
+		return caseMixed
+	case upper == 0:
+		return caseLower
+	case lower == 0 && upper > 1:
+		return caseUpper
+	case firstUpper && upper == 1:
+		return caseTitle
+	}
+	return caseMixed
+}
+
+func applyCase(c casing, s string) string {
+	switch c {
+	case caseLower:
+		return strings.ToLower(s)
+	case caseUpper:
+		return strings.ToUpper(s)
+	case caseTitle:
+		r, size := utf8.DecodeRuneInString(s)
+		return string(unicode.ToUpper(r)) + s[size:]
+	}
+	return s
+}
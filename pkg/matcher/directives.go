@@ -0,0 +1,63 @@
+package matcher
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// Directives that suppress matches, when they appear in a comment
+const (
+	// DirectiveIgnore suppresses matches on the same line
+	DirectiveIgnore = "inclusify:ignore"
+	// DirectiveIgnoreNextLine suppresses matches on the following line
+	DirectiveIgnoreNextLine = "inclusify:ignore-next-line"
+	// DirectiveDisable suppresses matches until the next DirectiveEnable, or the end of the file
+	DirectiveDisable = "inclusify:disable"
+	// DirectiveEnable ends a block started by DirectiveDisable
+	DirectiveEnable = "inclusify:enable"
+)
+
+// directivePrefix is common to all directives, and is used to skip files without any
+var directivePrefix = []byte("inclusify:")
+
+// directive matches a directive after a comment marker, e.g. '# inclusify:ignore',
+// '// inclusify:disable', '<!-- inclusify:ignore-next-line -->' or '-- inclusify:enable'.
+// A '--' only starts a comment on its own, so flags like '--force' never do.
+// Longer directives come first, since the leftmost alternative wins.
+var directive = regexp.MustCompile(`(?:#|//|/\*|<!--|(?:^|\s)--(?:\s|$)|^\s*\*)[^\n]*?\b(inclusify:(?:ignore-next-line|ignore|disable|enable))\b`)
+
+// suppressedLines returns the 1-based line numbers in content where matches are
+// suppressed by a directive, or nil if there are none
+func suppressedLines(content []byte) map[int]bool {
+	if !bytes.Contains(content, directivePrefix) {
+		return nil
+	}
+
+	lines := map[int]bool{}
+	disabled := false
+	ignoreNext := 0
+	for i, line := range bytes.Split(content, []byte("\n")) {
+		n := i + 1
+		if disabled || n == ignoreNext {
+			lines[n] = true
+		}
+
+		m := directive.FindSubmatch(line)
+		if m == nil {
+			continue
+		}
+		switch string(m[1]) {
+		case DirectiveIgnore:
+			lines[n] = true
+		case DirectiveIgnoreNextLine:
+			ignoreNext = n + 1
+		case DirectiveDisable:
+			disabled = true
+			lines[n] = true
+		case DirectiveEnable:
+			disabled = false
+		}
+	}
+
+	return lines
+}
@@ -0,0 +1,289 @@
+package matcher
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Mode controls which boundaries must surround a term for it to count as a match
+type Mode string
+
+const (
+	// ModeSubstring matches a term anywhere, e.g. 'master' in 'webmaster'
+	ModeSubstring Mode = "substring"
+	// ModeWord only matches a term surrounded by non-word characters, e.g. 'master' in 'origin/master'
+	ModeWord Mode = "word"
+	// ModeIdentifier behaves like ModeWord, but also treats camelCase, snake_case and
+	// kebab-case component boundaries as word boundaries, e.g. 'master' in 'masterBranch'
+	ModeIdentifier Mode = "identifier"
+)
+
+// ParseMode validates and returns the Mode named by s
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(strings.ToLower(s)); m {
+	case ModeSubstring, ModeWord, ModeIdentifier:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid match mode %q, must be one of '%s', '%s' or '%s'", s, ModeIdentifier, ModeWord, ModeSubstring)
+}
+
+// Term is a single reference to find, and what it should be replaced with.
+// Rule identifies the dictionary entry the term came from, if any.
+type Term struct {
+	From string
+	To   string
+	Rule string
+}
+
+// Match is a single occurrence of a Term within some content. Start and End are
+// byte offsets, Line and Column are 1-based, and Column is counted in runes.
+type Match struct {
+	Start       int
+	End         int
+	Line        int
+	Column      int
+	Text        string
+	Replacement string
+	Term        Term
+}
+
+// Matcher finds occurrences of a set of terms in file contents
+type Matcher struct {
+	terms         []Term
+	mode          Mode
+	caseSensitive bool
+	allowlist     []string
+
+	// needles are the folded terms, computed once since Find runs on every file
+	needles [][]byte
+}
+
+// New is a constructor for Matcher. Any match that overlaps one of the phrases in
+// allowlist is never reported, e.g. allowlisting 'master key' protects its 'master'.
+// Unless caseSensitive is set, terms and allowlisted phrases are matched ignoring
+// the case of ASCII letters, and each replacement follows the case of what it
+// replaces, e.g. 'MASTER' becomes 'MAIN' and 'Master' becomes 'Main'.
+func New(terms []Term, mode Mode, caseSensitive bool, allowlist []string) (*Matcher, error) {
+	if _, err := ParseMode(string(mode)); err != nil {
+		return nil, err
+	}
+	for _, t := range terms {
+		if t.From == "" {
+			return nil, fmt.Errorf("cannot match an empty term (replacement %q)", t.To)
+		}
+	}
+
+	var phrases []string
+	for _, p := range allowlist {
+		if p = strings.TrimSpace(p); p != "" {
+			phrases = append(phrases, p)
+		}
+	}
+
+	m := &Matcher{terms: terms, mode: mode, caseSensitive: caseSensitive, allowlist: phrases}
+	for _, t := range terms {
+		m.needles = append(m.needles, m.fold([]byte(t.From)))
+	}
+
+	return m, nil
+}
+
+// Find returns all non-overlapping matches in content, ordered by offset. Matches
+// on lines suppressed by an inclusify directive in a comment are never reported.
+func (m *Matcher) Find(content []byte) []Match {
+	// Lowercasing ASCII letters only never changes any offsets
+	haystack := m.fold(content)
+	var candidates []Match
+	for n, t := range m.terms {
+		needle := m.needles[n]
+		for offset := 0; offset <= len(content)-len(needle); {
+			i := indexFrom(haystack, needle, offset)
+			if i < 0 {
+				break
+			}
+			end := i + len(needle)
+			if m.bounded(content, i, end) {
+				text := string(content[i:end])
+				replacement := t.To
+				if !m.caseSensitive {
+					replacement = PreserveCase(text, t.From, t.To)
+				}
+				candidates = append(candidates, Match{
+					Start:       i,
+					End:         end,
+					Text:        text,
+					Replacement: replacement,
+					Term:        t,
+				})
+			}
+			offset = i + 1
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	// Prefer the earliest, then the longest, match when terms overlap
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Start != candidates[j].Start {
+			return candidates[i].Start < candidates[j].Start
+		}
+		return candidates[i].End > candidates[j].End
+	})
+
+	protected := m.protectedRanges(haystack)
+	var matches []Match
+	last := 0
+	for _, c := range candidates {
+		if c.Start < last || overlapsAny(c, protected) {
+			continue
+		}
+		matches = append(matches, c)
+		last = c.End
+	}
+
+	setPositions(content, matches)
+
+	return suppress(content, matches)
+}
+
+// Replace returns content with every match replaced, along with the matches
+func (m *Matcher) Replace(content []byte) ([]byte, []Match) {
+	matches := m.Find(content)
+	return Apply(content, matches), matches
+}
+
+// Apply returns content with the given matches replaced. The matches
+// must be ordered by offset and must not overlap, as returned by Find.
+func Apply(content []byte, matches []Match) []byte {
+	if len(matches) == 0 {
+		return content
+	}
+
+	var b bytes.Buffer
+	b.Grow(len(content))
+	last := 0
+	for _, match := range matches {
+		b.Write(content[last:match.Start])
+		b.WriteString(match.Replacement)
+		last = match.End
+	}
+	b.Write(content[last:])
+
+	return b.Bytes()
+}
+
+// bounded reports whether content[start:end] is surrounded by the boundaries
+// required by the matcher's mode
+func (m *Matcher) bounded(content []byte, start, end int) bool {
+	switch m.mode {
+	case ModeSubstring:
+		return true
+	case ModeWord:
+		return (start == 0 || !isWordByte(content[start-1])) &&
+			(end == len(content) || !isWordByte(content[end]))
+	}
+
+	left := start == 0 || !isAlnum(content[start-1]) ||
+		((isLower(content[start-1]) || isDigit(content[start-1])) && isUpper(content[start]))
+	right := end == len(content) || !isAlnum(content[end]) ||
+		(isUpper(content[end]) && isLower(content[end-1]))
+
+	return left && right
+}
+
+// protectedRanges returns the [start, end) offsets of every allowlisted phrase in
+// content, which has already been folded
+func (m *Matcher) protectedRanges(content []byte) [][2]int {
+	var ranges [][2]int
+	for _, p := range m.allowlist {
+		needle := m.fold([]byte(p))
+		for offset := 0; ; {
+			i := indexFrom(content, needle, offset)
+			if i < 0 {
+				break
+			}
+			ranges = append(ranges, [2]int{i, i + len(needle)})
+			offset = i + 1
+		}
+	}
+	return ranges
+}
+
+func overlapsAny(match Match, ranges [][2]int) bool {
+	for _, r := range ranges {
+		if match.Start < r[1] && r[0] < match.End {
+			return true
+		}
+	}
+	return false
+}
+
+// suppress drops the (positioned) matches on lines suppressed by a directive
+func suppress(content []byte, matches []Match) []Match {
+	lines := suppressedLines(content)
+	if len(lines) == 0 {
+		return matches
+	}
+
+	var kept []Match
+	for _, match := range matches {
+		if !lines[match.Line] {
+			kept = append(kept, match)
+		}
+	}
+	return kept
+}
+
+// fold returns b with ASCII letters lowercased, unless the matcher is case-sensitive
+func (m *Matcher) fold(b []byte) []byte {
+	if m.caseSensitive {
+		return b
+	}
+	folded := make([]byte, len(b))
+	for i, c := range b {
+		if isUpper(c) {
+			c += 'a' - 'A'
+		}
+		folded[i] = c
+	}
+	return folded
+}
+
+// setPositions fills in the line and column of each of the (ordered) matches
+func setPositions(content []byte, matches []Match) {
+	line, lineStart, pos := 1, 0, 0
+	for i := range matches {
+		for ; pos < matches[i].Start; pos++ {
+			if content[pos] == '\n' {
+				line++
+				lineStart = pos + 1
+			}
+		}
+		matches[i].Line = line
+		matches[i].Column = utf8.RuneCount(content[lineStart:matches[i].Start]) + 1
+	}
+}
+
+func indexFrom(content, needle []byte, offset int) int {
+	if offset > len(content) {
+		return -1
+	}
+	i := bytes.Index(content[offset:], needle)
+	if i < 0 {
+		return -1
+	}
+	return offset + i
+}
+
+func isLower(b byte) bool { return b >= 'a' && b <= 'z' }
+func isUpper(b byte) bool { return b >= 'A' && b <= 'Z' }
+func isDigit(b byte) bool { return b >= '0' && b <= '9' }
+
+// isAlnum treats any non-ASCII byte as a letter, so that we never split a multi-byte rune
+func isAlnum(b byte) bool { return isLower(b) || isUpper(b) || isDigit(b) || b >= utf8.RuneSelf }
+
+func isWordByte(b byte) bool { return isAlnum(b) || b == '_' }
@@ -0,0 +1,138 @@
+// +build !integration
+
+package matcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that each mode only replaces references at the expected boundaries
+func Test_Replace_Modes(t *testing.T) {
+	input := "git push origin master; mastermind remaster webmaster masterBranch master_branch master-branch master2"
+	terms := []Term{{From: "master", To: "main"}}
+
+	cases := map[Mode]string{
+		ModeSubstring:  "git push origin main; mainmind remain webmain mainBranch main_branch main-branch main2",
+		ModeWord:       "git push origin main; mastermind remaster webmaster masterBranch master_branch main-branch master2",
+		ModeIdentifier: "git push origin main; mastermind remaster webmaster mainBranch main_branch main-branch master2",
+	}
+
+	for mode, want := range cases {
+		m, err := New(terms, mode, true, nil)
+		require.NoError(t, err)
+
+		got, _ := m.Replace([]byte(input))
+		assert.Equal(t, want, string(got), "mode %s", mode)
+	}
+}
+
+// Test that allowlisted phrases are never rewritten
+func Test_Replace_Allowlist(t *testing.T) {
+	m, err := New([]Term{{From: "master", To: "main"}}, ModeIdentifier, true, []string{"master key", " "})
+	require.NoError(t, err)
+
+	got, matches := m.Replace([]byte("checkout master\nrotate the master key"))
+	assert.Equal(t, "checkout main\nrotate the master key", string(got))
+	assert.Len(t, matches, 1)
+}
+
+// Test that matches report their line and column
+func Test_Find_Positions(t *testing.T) {
+	m, err := New([]Term{{From: "master", To: "main"}}, ModeIdentifier, true, nil)
+	require.NoError(t, err)
+
+	matches := m.Find([]byte("branches:\n  - ü master\n"))
+	require.Len(t, matches, 1)
+	assert.Equal(t, 2, matches[0].Line)
+	assert.Equal(t, 7, matches[0].Column)
+	assert.Equal(t, "master", matches[0].Text)
+	assert.Equal(t, "main", matches[0].Replacement)
+}
+
+// Test that invalid modes and empty terms are rejected
+func Test_New_Invalid(t *testing.T) {
+	_, err := New([]Term{{From: "master", To: "main"}}, Mode("fuzzy"), true, nil)
+	assert.Error(t, err)
+
+	_, err = New([]Term{{From: "", To: "main"}}, ModeWord, true, nil)
+	assert.Error(t, err)
+}
+
+// Test that matching ignores case by default, and that replacements follow the case of each match
+func Test_Replace_PreserveCase(t *testing.T) {
+	terms := []Term{{From: "master", To: "main"}, {From: "sanity check", To: "confidence check"}}
+	m, err := New(terms, ModeIdentifier, false, []string{"Master Key"})
+	require.NoError(t, err)
+
+	input := "master Master MASTER MASTER_BRANCH MasterBranch masterBranch MASTERBRANCH\nSanity Check, SANITY CHECK\nthe MASTER KEY"
+	want := "main Main MAIN MAIN_BRANCH MainBranch mainBranch MASTERBRANCH\nConfidence Check, CONFIDENCE CHECK\nthe MASTER KEY"
+	got, matches := m.Replace([]byte(input))
+	assert.Equal(t, want, string(got))
+	assert.Len(t, matches, 8)
+
+	m, err = New(terms, ModeIdentifier, true, nil)
+	require.NoError(t, err)
+	got, _ = m.Replace([]byte("master Master MASTER"))
+	assert.Equal(t, "main Master MASTER", string(got))
+}
+
+// Test that the case pattern of each match is applied to the replacement
+func Test_PreserveCase(t *testing.T) {
+	cases := []struct{ text, from, to, want string }{
+		{"master", "master", "main", "main"},
+		{"Master", "master", "main", "Main"},
+		{"MASTER", "master", "main", "MAIN"},
+		{"mAsTeR", "master", "main", "main"},
+		{"Whitelist", "whitelist", "allowList", "AllowList"},
+		{"blacklist", "Blacklist", "Denylist", "denylist"},
+		{"Sanity check", "sanity check", "confidence check", "Confidence check"},
+		{"sanity Check", "sanity check", "confidence check", "confidence Check"},
+		{"Slave node", "slave node", "replica", "Replica"},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.want, PreserveCase(c.text, c.from, c.to), c.text)
+	}
+}
+
+// Test that directives in any comment syntax suppress matches
+func Test_Find_Directives(t *testing.T) {
+	m, err := New([]Term{{From: "master", To: "main"}}, ModeIdentifier, true, nil)
+	require.NoError(t, err)
+
+	input := `git push origin master
+git clone -b master other/repo # inclusify:ignore
+// inclusify:ignore-next-line
+fetch("https://example.com/other/master/raw")
+<!-- inclusify:disable -->
+See the master branch of other/repo
+-- master is used by the upstream fork
+<!-- inclusify:enable -->
+echo master
+/* inclusify:ignore */ git checkout master
+notacomment inclusify:ignore master
+SELECT 'master' -- inclusify:ignore
+git push --force origin master --reason=inclusify:ignore
+`
+	want := `git push origin main
+git clone -b master other/repo # inclusify:ignore
+// inclusify:ignore-next-line
+fetch("https://example.com/other/master/raw")
+<!-- inclusify:disable -->
+See the master branch of other/repo
+-- master is used by the upstream fork
+<!-- inclusify:enable -->
+echo main
+/* inclusify:ignore */ git checkout master
+notacomment inclusify:ignore main
+SELECT 'master' -- inclusify:ignore
+git push --force origin main --reason=inclusify:ignore
+`
+	got, matches := m.Replace([]byte(input))
+	assert.Equal(t, want, string(got))
+	assert.Len(t, matches, 4)
+	assert.Equal(t, 9, matches[1].Line)
+}
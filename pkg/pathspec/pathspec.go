@@ -0,0 +1,184 @@
+package pathspec
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// pattern is a single compiled gitignore-style pattern
+type pattern struct {
+	raw      string
+	segments []string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// PathSpec matches repo-relative paths against a list of gitignore-style
+// patterns. As with .gitignore:
+//
+//   - a pattern without a slash matches a file or dir name at any depth, e.g. 'README.md'
+//   - a pattern with a leading or middle slash is anchored to the repo root, e.g. '/docs/*.md'
+//   - a trailing slash only matches directories, e.g. 'vendor/'
+//   - '*' and '?' never match a slash, while '**' matches any number of directories
+//   - a leading '!' re-includes paths excluded by an earlier pattern, and the last match wins
+type PathSpec struct {
+	patterns []pattern
+}
+
+// Compile parses the given patterns. Blank patterns and comments starting with
+// '#' are ignored.
+func Compile(patterns []string) (*PathSpec, error) {
+	ps := &PathSpec{}
+	for _, raw := range patterns {
+		p := strings.TrimSpace(raw)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+
+		compiled := pattern{raw: p}
+		if strings.HasPrefix(p, "!") {
+			compiled.negate = true
+			p = p[1:]
+		}
+		if strings.HasSuffix(p, "/") {
+			compiled.dirOnly = true
+			p = strings.TrimRight(p, "/")
+		}
+		if strings.Contains(p, "/") {
+			compiled.anchored = true
+			p = strings.TrimPrefix(p, "/")
+		}
+		if p == "" {
+			return nil, fmt.Errorf("invalid path pattern %q", raw)
+		}
+
+		compiled.segments = strings.Split(p, "/")
+		for _, segment := range compiled.segments {
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("invalid path pattern %q: %w", raw, err)
+			}
+		}
+		if !compiled.anchored {
+			compiled.segments = append([]string{"**"}, compiled.segments...)
+		}
+
+		ps.patterns = append(ps.patterns, compiled)
+	}
+
+	return ps, nil
+}
+
+// Empty returns true if there are no patterns to match against
+func (ps *PathSpec) Empty() bool {
+	return ps == nil || len(ps.patterns) == 0
+}
+
+// Match returns true if the slash-separated path, relative to the repo root,
+// matches the patterns. isDir should be true if the path is a directory. A path
+// inside a matching directory also matches, but unlike .gitignore, a later
+// negated pattern can still re-include it, e.g. '.circleci/' and '!.circleci/config.yml'.
+func (ps *PathSpec) Match(rel string, isDir bool) bool {
+	if ps.Empty() {
+		return false
+	}
+
+	segments := split(rel)
+	matched := false
+	for _, p := range ps.patterns {
+		if p.matches(segments, isDir) {
+			matched = !p.negate
+		}
+	}
+
+	return matched
+}
+
+// Prune returns true if the directory, and everything in it, matches the
+// patterns, so a walker can skip it entirely. A negated pattern that matches
+// the directory itself already counts in Match, so only one that could match
+// something below it, e.g. '!docs/keep.md' for 'docs', prevents pruning.
+func (ps *PathSpec) Prune(rel string) bool {
+	if !ps.Match(rel, true) {
+		return false
+	}
+	segments := split(rel)
+	for _, p := range ps.patterns {
+		if p.negate && !p.matches(segments, true) && matchBelow(p.segments, segments) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the patterns as they were given
+func (ps *PathSpec) String() string {
+	var raw []string
+	if ps != nil {
+		for _, p := range ps.patterns {
+			raw = append(raw, p.raw)
+		}
+	}
+	return strings.Join(raw, ",")
+}
+
+// split returns the segments of the slash-separated path
+func split(rel string) []string {
+	return strings.Split(strings.Trim(path.Clean("/"+rel), "/"), "/")
+}
+
+// matches returns true if the pattern matches the path or any of its parent dirs
+func (p pattern) matches(segments []string, isDir bool) bool {
+	for i := 1; i <= len(segments); i++ {
+		parentIsDir := i < len(segments) || isDir
+		if p.dirOnly && !parentIsDir {
+			continue
+		}
+		if matchSegments(p.segments, segments[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchSegments matches path segments against pattern segments, where a '**'
+// pattern segment matches zero or more path segments
+func matchSegments(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(segments); i++ {
+				if matchSegments(pattern[1:], segments[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(segments) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return len(segments) == 0
+}
+
+// matchBelow returns true if the pattern segments could match a path inside the
+// dir with the given segments
+func matchBelow(pattern, segments []string) bool {
+	for len(pattern) > 0 {
+		// '**' can match the rest of the dir, and whatever is below it
+		if pattern[0] == "**" || len(segments) == 0 {
+			return true
+		}
+		if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+			return false
+		}
+		pattern, segments = pattern[1:], segments[1:]
+	}
+
+	return false
+}
@@ -0,0 +1,75 @@
+// +build !integration
+
+package pathspec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that patterns follow gitignore matching rules relative to the repo root
+func Test_Match(t *testing.T) {
+	ps, err := Compile([]string{"README.md", "/docs/*.tmpl", "vendor/", "scripts/**/*.py", ".circleci/", "!.circleci/config.yml", "# comment", ""})
+	require.NoError(t, err)
+
+	cases := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"README.md", false, true},
+		{"docs/README.md", false, true},
+		{"docs/README.md.tmpl", false, true},
+		{"docs/nested/README.md.tmpl", false, false},
+		{"vendor", true, true},
+		{"pkg/vendor/lib.go", false, true},
+		{"pkg/vendor", false, false},
+		{"scripts/hello.py", false, true},
+		{"scripts/a/b/hello.py", false, true},
+		{"scripts/hello.sh", false, false},
+		{".circleci/Makefile", false, true},
+		{".circleci/config.yml", false, false},
+		{"test/main.go", false, false},
+	}
+
+	for _, c := range cases {
+		assert.Equal(t, c.want, ps.Match(c.path, c.isDir), c.path)
+	}
+
+	assert.True(t, ps.Prune("vendor"), "no negated pattern matches inside vendor/")
+	assert.False(t, ps.Prune(".circleci"), "!.circleci/config.yml prevents pruning")
+}
+
+// Test that directories can only be pruned when nothing inside them can be re-included
+func Test_Prune(t *testing.T) {
+	ps, err := Compile([]string{".git/", "node_modules"})
+	require.NoError(t, err)
+
+	assert.True(t, ps.Prune(".git"))
+	assert.True(t, ps.Prune("web/node_modules"))
+	assert.False(t, ps.Prune("pkg"))
+	assert.Equal(t, ".git/,node_modules", ps.String())
+
+	ps, err = Compile([]string{".git/", "docs/", "!docs/keep.md", "build/", "!build/**/*.md"})
+	require.NoError(t, err)
+
+	assert.True(t, ps.Prune(".git"), "!docs/keep.md can't match inside .git/")
+	assert.False(t, ps.Prune("docs"))
+	assert.False(t, ps.Prune("build/out"))
+
+	ps, err = Compile([]string{".git/", "!*.keep"})
+	require.NoError(t, err)
+
+	assert.False(t, ps.Prune(".git"), "!*.keep can match at any depth")
+}
+
+// Test that malformed patterns are rejected
+func Test_Compile_Invalid(t *testing.T) {
+	_, err := Compile([]string{"docs/[a-"})
+	assert.Error(t, err)
+
+	_, err = Compile([]string{"!"})
+	assert.Error(t, err)
+}
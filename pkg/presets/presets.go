@@ -0,0 +1,201 @@
+package presets
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Special preset names that can be passed to `INCLUSIFY_PRESETS`
+const (
+	// Auto detects the presets from the marker files in the repo
+	Auto = "auto"
+	// None disables every preset
+	None = "none"
+)
+
+// Preset is a set of exclusion patterns for the dependencies, lockfiles and
+// build output of an ecosystem. It applies to a repo that contains any of its
+// markers, which are matched against file names like filepath.Match.
+type Preset struct {
+	Name      string
+	Markers   []string
+	Exclusion []string
+}
+
+// All is every preset we know about, ordered by name
+var All = []Preset{
+	{
+		Name:      "go",
+		Markers:   []string{"go.mod"},
+		Exclusion: []string{"go.mod", "go.sum", "vendor/"},
+	},
+	{
+		Name:      "node",
+		Markers:   []string{"package.json"},
+		Exclusion: []string{"node_modules/", "package-lock.json", "npm-shrinkwrap.json", "yarn.lock", "pnpm-lock.yaml"},
+	},
+	{
+		Name:      "php",
+		Markers:   []string{"composer.json"},
+		Exclusion: []string{"vendor/", "composer.lock"},
+	},
+	{
+		Name:      "python",
+		Markers:   []string{"pyproject.toml", "setup.py", "setup.cfg", "requirements*.txt", "Pipfile"},
+		Exclusion: []string{"poetry.lock", "Pipfile.lock", ".venv/", "__pycache__/"},
+	},
+	{
+		Name:      "ruby",
+		Markers:   []string{"Gemfile", "*.gemspec"},
+		Exclusion: []string{"vendor/", "Gemfile.lock"},
+	},
+	{
+		Name:      "rust",
+		Markers:   []string{"Cargo.toml"},
+		Exclusion: []string{"Cargo.lock", "target/"},
+	},
+	{
+		Name:      "terraform",
+		Markers:   []string{"*.tf"},
+		Exclusion: []string{".terraform/", ".terraform.lock.hcl"},
+	},
+}
+
+// Names returns the names of every preset
+func Names() []string {
+	names := make([]string, len(All))
+	for i, p := range All {
+		names[i] = p.Name
+	}
+	return names
+}
+
+// Lookup returns the preset with the given name
+func Lookup(name string) (Preset, error) {
+	for _, p := range All {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+	}
+	return Preset{}, fmt.Errorf("unknown preset %q, must be '%s', '%s' or one of '%s'", name, Auto, None, strings.Join(Names(), "', '"))
+}
+
+// Validate checks a list of preset names, as passed to `INCLUSIFY_PRESETS`
+func Validate(names []string) error {
+	for _, name := range names {
+		if name == Auto || name == None {
+			continue
+		}
+		if _, err := Lookup(name); err != nil {
+			return err
+		}
+	}
+	if len(names) > 1 {
+		for _, name := range names {
+			if name == None {
+				return fmt.Errorf("preset '%s' cannot be combined with other presets", None)
+			}
+		}
+	}
+	return nil
+}
+
+// Detect returns the presets whose markers are found at the root of the repo
+// at dir, or in any of its top-level directories. Hidden and excluded
+// directories, such as node_modules/, are never searched.
+func Detect(dir string) ([]Preset, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, fi := range entries {
+		if !fi.IsDir() {
+			names = append(names, fi.Name())
+			continue
+		}
+		if strings.HasPrefix(fi.Name(), ".") || isExcludedDir(fi.Name()) {
+			continue
+		}
+		sub, err := ioutil.ReadDir(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		for _, subFi := range sub {
+			if !subFi.IsDir() {
+				names = append(names, subFi.Name())
+			}
+		}
+	}
+
+	var detected []Preset
+	for _, p := range All {
+		if matchesAny(p.Markers, names) {
+			detected = append(detected, p)
+		}
+	}
+	return detected, nil
+}
+
+// Resolve returns the presets named by names, as passed to `INCLUSIFY_PRESETS`,
+// detecting them in the repo at dir if they include Auto. The result is ordered
+// by name, and every preset appears once.
+func Resolve(names []string, dir string) ([]Preset, error) {
+	seen := map[string]bool{}
+	var resolved []Preset
+	for _, name := range names {
+		switch name {
+		case None:
+			continue
+		case Auto:
+			detected, err := Detect(dir)
+			if err != nil {
+				return nil, fmt.Errorf("failed to detect presets: %w", err)
+			}
+			for _, p := range detected {
+				if !seen[p.Name] {
+					seen[p.Name] = true
+					resolved = append(resolved, p)
+				}
+			}
+		default:
+			p, err := Lookup(name)
+			if err != nil {
+				return nil, err
+			}
+			if !seen[p.Name] {
+				seen[p.Name] = true
+				resolved = append(resolved, p)
+			}
+		}
+	}
+
+	sort.Slice(resolved, func(i, j int) bool { return resolved[i].Name < resolved[j].Name })
+	return resolved, nil
+}
+
+// isExcludedDir returns true if name is a directory that some preset excludes
+func isExcludedDir(name string) bool {
+	for _, p := range All {
+		for _, pattern := range p.Exclusion {
+			if pattern == name+"/" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func matchesAny(patterns, names []string) bool {
+	for _, pattern := range patterns {
+		for _, name := range names {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+// +build !integration
+
+package presets
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func names(presets []Preset) []string {
+	var names []string
+	for _, p := range presets {
+		names = append(names, p.Name)
+	}
+	return names
+}
+
+// Test that presets are detected from markers at the root and in top-level directories only
+func Test_Detect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inclusify-presets")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{
+		"go.mod",
+		"web/package.json",
+		"infra/main.tf",
+		"web/node_modules/left-pad/Cargo.toml",
+		"docs/examples/python/setup.py",
+		".github/Gemfile",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, nil, 0644))
+	}
+
+	detected, err := Detect(dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "node", "terraform"}, names(detected))
+
+	resolved, err := Resolve([]string{"rust", Auto, "node"}, dir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "node", "rust", "terraform"}, names(resolved))
+
+	resolved, err = Resolve([]string{None}, dir)
+	require.NoError(t, err)
+	assert.Empty(t, resolved)
+}
+
+// Test that unknown presets, and 'none' combined with others, are rejected
+func Test_Validate(t *testing.T) {
+	assert.NoError(t, Validate([]string{Auto}))
+	assert.NoError(t, Validate([]string{"node", "terraform"}))
+	assert.NoError(t, Validate([]string{None}))
+	assert.EqualError(t, Validate([]string{"cobol"}), `unknown preset "cobol", must be 'auto', 'none' or one of 'go', 'node', 'php', 'python', 'ruby', 'rust', 'terraform'`)
+	assert.EqualError(t, Validate([]string{None, "node"}), "preset 'none' cannot be combined with other presets")
+}
@@ -0,0 +1,217 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	nethttp "net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// DefaultHost is the host of repos on github.com. Repos on a GitHub Enterprise
+// Server are on the host of its API URL, unless another git host is set.
+const DefaultHost = "github.com"
+
+// Methods of authenticating with the remote when cloning and pushing
+const (
+	// AuthToken uses HTTPS basic auth with the GitHub token
+	AuthToken = "token"
+	// AuthSSHKey uses an SSH private key, such as a deploy key
+	AuthSSHKey = "ssh-key"
+	// AuthSSHAgent uses the keys held by the running ssh-agent
+	AuthSSHAgent = "ssh-agent"
+	// AuthCredentialHelper asks the git credential helpers configured on the host, like `git credential fill`
+	AuthCredentialHelper = "credential-helper"
+)
+
+// URL templates for the remote of a repo. {host}, {owner} and {repo} are replaced
+// with the git host, and the owner and name of the repo.
+const (
+	HTTPSTemplate = "https://{host}/{owner}/{repo}.git"
+	SSHTemplate   = "git@{host}:{owner}/{repo}.git"
+)
+
+// Options configure how the remote is reached
+type Options struct {
+	// Method is one of the Auth* constants
+	Method string
+	// URLTemplate overrides the default template for Method
+	URLTemplate string
+	// Host is the git host of the repo, e.g. the host of a GitHub Enterprise
+	// Server. It defaults to github.com.
+	Host  string
+	Token string
+	// SSHKey is the path to the private key used by AuthSSHKey
+	SSHKey           string
+	SSHKeyPassphrase string
+	// SSHKnownHosts is the path to a known_hosts file used to verify the host key of
+	// the remote. It defaults to $SSH_KNOWN_HOSTS, or ~/.ssh/known_hosts.
+	SSHKnownHosts string
+}
+
+// ParseMethod validates and returns the method named by s
+func ParseMethod(s string) (string, error) {
+	switch m := strings.ToLower(s); m {
+	case AuthToken, AuthSSHKey, AuthSSHAgent, AuthCredentialHelper:
+		return m, nil
+	case "":
+		return AuthToken, nil
+	}
+	return "", fmt.Errorf("invalid git auth method %q, must be one of '%s', '%s', '%s' or '%s'", s, AuthToken, AuthSSHKey, AuthSSHAgent, AuthCredentialHelper)
+}
+
+// IsSSH returns true if the method connects over SSH
+func (o Options) IsSSH() bool {
+	return o.Method == AuthSSHKey || o.Method == AuthSSHAgent
+}
+
+// URL returns the remote URL of owner/repo
+func (o Options) URL(owner, repo string) string {
+	template := o.URLTemplate
+	if template == "" {
+		template = HTTPSTemplate
+		if o.IsSSH() {
+			template = SSHTemplate
+		}
+	}
+	host := o.Host
+	if host == "" {
+		host = DefaultHost
+	}
+	return strings.NewReplacer("{host}", host, "{owner}", owner, "{repo}", repo).Replace(template)
+}
+
+// Host returns the host of the repos on the GitHub Enterprise Server whose API
+// is at baseURL, or DefaultHost if baseURL is empty
+func Host(baseURL string) (string, error) {
+	if baseURL == "" {
+		return DefaultHost, nil
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid GitHub API URL %q, it must be absolute, e.g. 'https://github.example.com/api/v3/'", baseURL)
+	}
+	return strings.TrimPrefix(u.Host, "api."), nil
+}
+
+// InstallHTTPClient makes every HTTP and HTTPS git remote use client, e.g. one
+// that trusts a custom CA or goes through a proxy
+func InstallHTTPClient(c *nethttp.Client) {
+	client.InstallProtocol("https", http.NewClient(c))
+	client.InstallProtocol("http", http.NewClient(c))
+}
+
+// Auth returns the auth method used to clone from and push to remoteURL
+func (o Options) Auth(remoteURL string) (transport.AuthMethod, error) {
+	switch o.Method {
+	case AuthSSHKey:
+		auth, err := ssh.NewPublicKeysFromFile(sshUser(remoteURL), o.SSHKey, o.SSHKeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SSH key %s: %w", o.SSHKey, err)
+		}
+		if auth.HostKeyCallback, err = o.knownHosts(); err != nil {
+			return nil, err
+		}
+		return auth, nil
+	case AuthSSHAgent:
+		auth, err := ssh.NewSSHAgentAuth(sshUser(remoteURL))
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+		}
+		if auth.HostKeyCallback, err = o.knownHosts(); err != nil {
+			return nil, err
+		}
+		return auth, nil
+	case AuthCredentialHelper:
+		return credentialHelperAuth(remoteURL)
+	}
+
+	return &http.BasicAuth{
+		Username: "irrelevant", // This cannot be an empty string
+		Password: o.Token,
+	}, nil
+}
+
+// knownHosts returns the callback that verifies the host key of the remote
+func (o Options) knownHosts() (gossh.HostKeyCallback, error) {
+	var files []string
+	if o.SSHKnownHosts != "" {
+		files = append(files, o.SSHKnownHosts)
+	}
+	callback, err := ssh.NewKnownHostsCallback(files...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load SSH known hosts: %w", err)
+	}
+	return callback, nil
+}
+
+// scpURL matches scp-like SSH URLs, e.g. 'git@github.com:owner/repo.git'
+var scpURL = regexp.MustCompile(`^(?:([^@/]+)@)?([^:/]+):(.*)$`)
+
+// sshUser returns the user in an SSH URL, or 'git'
+func sshUser(remoteURL string) string {
+	if u, err := url.Parse(remoteURL); err == nil && u.Scheme != "" && u.User != nil {
+		return u.User.Username()
+	}
+	if m := scpURL.FindStringSubmatch(remoteURL); m != nil && m[1] != "" {
+		return m[1]
+	}
+	return ssh.DefaultUsername
+}
+
+// credentialHelperAuth asks git for the credentials of an HTTPS remoteURL, like
+// `git credential fill`. Git never prompts for them, so that CI runs can't hang.
+func credentialHelperAuth(remoteURL string) (transport.AuthMethod, error) {
+	u, err := url.Parse(remoteURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return nil, fmt.Errorf("credential helpers can only be used with HTTPS remotes, got %s", remoteURL)
+	}
+
+	input := fmt.Sprintf("protocol=%s\nhost=%s\npath=%s\n\n", u.Scheme, u.Host, strings.TrimPrefix(u.Path, "/"))
+	cmd := exec.Command("git", "credential", "fill")
+	cmd.Stdin = strings.NewReader(input)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get credentials for %s from git credential helpers: %w: %s", u.Host, err, strings.TrimSpace(stderr.String()))
+	}
+
+	auth := &http.BasicAuth{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		key, value := splitCredential(scanner.Text())
+		switch key {
+		case "username":
+			auth.Username = value
+		case "password":
+			auth.Password = value
+		}
+	}
+	if auth.Password == "" {
+		return nil, fmt.Errorf("git credential helpers returned no password for %s", u.Host)
+	}
+	if auth.Username == "" {
+		auth.Username = "irrelevant" // This cannot be an empty string
+	}
+
+	return auth, nil
+}
+
+func splitCredential(line string) (key, value string) {
+	if i := strings.IndexByte(line, '='); i >= 0 {
+		return line[:i], line[i+1:]
+	}
+	return line, ""
+}
@@ -0,0 +1,121 @@
+// +build !integration
+
+package remote
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test that the remote URL depends on the auth method, unless a template is set
+func Test_URL(t *testing.T) {
+	assert.Equal(t, "https://github.com/hashicorp/test.git", Options{Method: AuthToken}.URL("hashicorp", "test"))
+	assert.Equal(t, "https://github.com/hashicorp/test.git", Options{Method: AuthCredentialHelper}.URL("hashicorp", "test"))
+	assert.Equal(t, "git@github.com:hashicorp/test.git", Options{Method: AuthSSHKey}.URL("hashicorp", "test"))
+	assert.Equal(t, "git@github.com:hashicorp/test.git", Options{Method: AuthSSHAgent}.URL("hashicorp", "test"))
+	assert.Equal(t, "git@github.example.com:hashicorp/test.git", Options{Method: AuthSSHAgent, Host: "github.example.com"}.URL("hashicorp", "test"))
+	assert.Equal(t, "ssh://deploy@git.example.com:2222/hashicorp/test", Options{
+		Method:      AuthSSHKey,
+		URLTemplate: "ssh://deploy@git.example.com:2222/{owner}/{repo}",
+	}.URL("hashicorp", "test"))
+}
+
+// Test that auth methods are parsed in any case, defaulting to a token
+func Test_ParseMethod(t *testing.T) {
+	for in, want := range map[string]string{"": AuthToken, "token": AuthToken, "SSH-Key": AuthSSHKey, "ssh-agent": AuthSSHAgent, "credential-helper": AuthCredentialHelper} {
+		got, err := ParseMethod(in)
+		require.NoError(t, err, in)
+		assert.Equal(t, want, got, in)
+	}
+	_, err := ParseMethod("password")
+	assert.Error(t, err)
+}
+
+// Test that the SSH user is taken from the remote URL, defaulting to 'git'
+func Test_sshUser(t *testing.T) {
+	assert.Equal(t, "git", sshUser("git@github.com:hashicorp/test.git"))
+	assert.Equal(t, "deploy", sshUser("ssh://deploy@git.example.com:2222/hashicorp/test"))
+	assert.Equal(t, "git", sshUser("ssh://git.example.com/hashicorp/test"))
+}
+
+// Test that the token is used for HTTPS basic auth
+func Test_Auth_Token(t *testing.T) {
+	auth, err := Options{Method: AuthToken, Token: "token"}.Auth("https://github.com/hashicorp/test.git")
+	require.NoError(t, err)
+	assert.Equal(t, &http.BasicAuth{Username: "irrelevant", Password: "token"}, auth)
+}
+
+// Test that SSH keys are loaded for the user in the remote URL
+func Test_Auth_SSHKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remote")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	keyPath := filepath.Join(dir, "id_rsa")
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	require.NoError(t, ioutil.WriteFile(keyPath, pemKey, 0600))
+	knownHosts := filepath.Join(dir, "known_hosts")
+	require.NoError(t, ioutil.WriteFile(knownHosts, nil, 0600))
+
+	opts := Options{Method: AuthSSHKey, SSHKey: keyPath, SSHKnownHosts: knownHosts}
+	auth, err := opts.Auth("deploy@git.example.com:hashicorp/test.git")
+	require.NoError(t, err)
+	keys, ok := auth.(*ssh.PublicKeys)
+	require.True(t, ok)
+	assert.Equal(t, "deploy", keys.User)
+	assert.Equal(t, "ssh-rsa", keys.Signer.PublicKey().Type())
+	assert.NotNil(t, keys.HostKeyCallback)
+
+	opts.SSHKey = filepath.Join(dir, "missing")
+	_, err = opts.Auth("git@github.com:hashicorp/test.git")
+	assert.Error(t, err)
+}
+
+// Test that credentials are read from the git credential helpers
+func Test_Auth_CredentialHelper(t *testing.T) {
+	os.Setenv("GIT_CONFIG_COUNT", "1")
+	os.Setenv("GIT_CONFIG_KEY_0", "credential.helper")
+	os.Setenv("GIT_CONFIG_VALUE_0", "!f() { echo username=deploy; echo password=secret; }; f")
+	defer func() {
+		os.Unsetenv("GIT_CONFIG_COUNT")
+		os.Unsetenv("GIT_CONFIG_KEY_0")
+		os.Unsetenv("GIT_CONFIG_VALUE_0")
+	}()
+
+	auth, err := Options{Method: AuthCredentialHelper}.Auth("https://github.com/hashicorp/test.git")
+	require.NoError(t, err)
+	assert.Equal(t, &http.BasicAuth{Username: "deploy", Password: "secret"}, auth)
+
+	_, err = Options{Method: AuthCredentialHelper}.Auth("git@github.com:hashicorp/test.git")
+	assert.Error(t, err)
+}
+
+// Test that the git host is derived from the API URL, without any 'api.' prefix
+func Test_Host(t *testing.T) {
+	for baseURL, want := range map[string]string{
+		"":                                   "github.com",
+		"https://github.example.com/api/v3/": "github.example.com",
+		"https://api.github.example.com/":    "github.example.com",
+		"https://github.example.com:8443/":   "github.example.com:8443",
+	} {
+		host, err := Host(baseURL)
+		require.NoError(t, err, baseURL)
+		assert.Equal(t, want, host, baseURL)
+	}
+
+	_, err := Host("github.example.com/api/v3")
+	assert.Error(t, err)
+}
@@ -0,0 +1,169 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Formats of signing keys, named like git's gpg.format
+const (
+	FormatOpenPGP = "openpgp"
+	FormatSSH     = "ssh"
+)
+
+// Signer creates the signature stored in the 'gpgsig' header of a commit, from
+// the encoded commit without that header. go-git signs commits with GPG keys
+// itself, so this is only needed for SSH keys.
+type Signer interface {
+	Sign(message []byte) (signature string, err error)
+}
+
+// ParseFormat validates and returns the format named by s. 'gpg' is accepted as
+// an alias of 'openpgp'.
+func ParseFormat(s string) (string, error) {
+	switch strings.ToLower(s) {
+	case FormatOpenPGP, "gpg", "":
+		return FormatOpenPGP, nil
+	case FormatSSH:
+		return FormatSSH, nil
+	}
+	return "", fmt.Errorf("invalid signing format %q, must be '%s' or '%s'", s, FormatOpenPGP, FormatSSH)
+}
+
+// LoadOpenPGP reads the GPG private key at path, for go-git to sign commits
+// with, like `git commit -S`. The key is decrypted with passphrase if it is
+// protected.
+func LoadOpenPGP(path, passphrase string) (*openpgp.Entity, error) {
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	entities, err := openpgp.ReadArmoredKeyRing(bytes.NewReader(key))
+	if err != nil {
+		entities, err = openpgp.ReadKeyRing(bytes.NewReader(key))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse GPG signing key: %w", err)
+	}
+	if len(entities) == 0 || entities[0].PrivateKey == nil {
+		return nil, fmt.Errorf("failed to parse GPG signing key: no private key found")
+	}
+
+	entity := entities[0]
+	if entity.PrivateKey.Encrypted {
+		if err := entity.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt GPG signing key: %w", err)
+		}
+	}
+	for _, subkey := range entity.Subkeys {
+		if subkey.PrivateKey != nil && subkey.PrivateKey.Encrypted {
+			if err := subkey.PrivateKey.Decrypt([]byte(passphrase)); err != nil {
+				return nil, fmt.Errorf("failed to decrypt GPG signing subkey: %w", err)
+			}
+		}
+	}
+
+	return entity, nil
+}
+
+// LoadSSH reads the SSH private key at path and returns a Signer for it. The
+// key is decrypted with passphrase if it is protected.
+func LoadSSH(path, passphrase string) (Signer, error) {
+	key, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+	return newSSHSigner(key, passphrase)
+}
+
+// sshSigner signs with an SSH key, like `git commit -S` with gpg.format=ssh. The
+// signature uses the SSHSIG format of `ssh-keygen -Y sign -n git`.
+type sshSigner struct {
+	signer ssh.Signer
+}
+
+// sshNamespace is the namespace git uses for commit and tag signatures
+const sshNamespace = "git"
+
+func newSSHSigner(key []byte, passphrase string) (*sshSigner, error) {
+	signer, err := ssh.ParsePrivateKey(key)
+	if _, ok := err.(*ssh.PassphraseMissingError); ok && passphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH signing key: %w", err)
+	}
+	return &sshSigner{signer: signer}, nil
+}
+
+func (s *sshSigner) Sign(message []byte) (signature string, err error) {
+	hash := sha512.Sum512(message)
+	signed := sshsigBlob(
+		[]byte(sshNamespace),
+		nil,
+		[]byte("sha512"),
+		hash[:],
+	)
+
+	var sig *ssh.Signature
+	if algSigner, ok := s.signer.(ssh.AlgorithmSigner); ok && s.signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		// SSHSIG requires SHA-2 signatures for RSA keys
+		sig, err = algSigner.SignWithAlgorithm(nil, signed, ssh.SigAlgoRSASHA2512)
+	} else {
+		sig, err = s.signer.Sign(nil, signed)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to sign with SSH key: %w", err)
+	}
+
+	var blob bytes.Buffer
+	blob.WriteString("SSHSIG")
+	binary.Write(&blob, binary.BigEndian, uint32(1))
+	writeString(&blob, s.signer.PublicKey().Marshal())
+	writeString(&blob, []byte(sshNamespace))
+	writeString(&blob, nil)
+	writeString(&blob, []byte("sha512"))
+	writeString(&blob, ssh.Marshal(sig))
+
+	return armor(blob.Bytes()), nil
+}
+
+// sshsigBlob returns the data that is actually signed for an SSHSIG signature
+func sshsigBlob(namespace, reserved, hashAlg, hash []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("SSHSIG")
+	writeString(&b, namespace)
+	writeString(&b, reserved)
+	writeString(&b, hashAlg)
+	writeString(&b, hash)
+	return b.Bytes()
+}
+
+// writeString writes s as an SSH wire format string, i.e. prefixed by its length
+func writeString(b *bytes.Buffer, s []byte) {
+	binary.Write(b, binary.BigEndian, uint32(len(s)))
+	b.Write(s)
+}
+
+// armor encodes an SSHSIG blob like ssh-keygen does, in lines of 70 characters
+func armor(blob []byte) string {
+	encoded := base64.StdEncoding.EncodeToString(blob)
+	var b strings.Builder
+	b.WriteString("-----BEGIN SSH SIGNATURE-----\n")
+	for len(encoded) > 70 {
+		b.WriteString(encoded[:70] + "\n")
+		encoded = encoded[70:]
+	}
+	b.WriteString(encoded + "\n")
+	b.WriteString("-----END SSH SIGNATURE-----\n")
+	return b.String()
+}
@@ -0,0 +1,131 @@
+// +build !integration
+
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+)
+
+// verifySSHSIG checks an armored SSHSIG signature of message, and returns the key that made it
+func verifySSHSIG(t *testing.T, armored string, message []byte) ssh.PublicKey {
+	lines := strings.Split(strings.TrimSpace(armored), "\n")
+	require.Equal(t, "-----BEGIN SSH SIGNATURE-----", lines[0])
+	require.Equal(t, "-----END SSH SIGNATURE-----", lines[len(lines)-1])
+	for _, line := range lines[1 : len(lines)-1] {
+		assert.LessOrEqual(t, len(line), 70)
+	}
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(lines[1:len(lines)-1], ""))
+	require.NoError(t, err)
+
+	var sig struct {
+		Version   uint32
+		PublicKey []byte
+		Namespace string
+		Reserved  string
+		HashAlg   string
+		Signature []byte
+	}
+	require.True(t, bytes.HasPrefix(blob, []byte("SSHSIG")))
+	require.NoError(t, ssh.Unmarshal(blob[len("SSHSIG"):], &sig))
+	assert.Equal(t, uint32(1), sig.Version)
+	assert.Equal(t, "git", sig.Namespace)
+	assert.Equal(t, "sha512", sig.HashAlg)
+
+	pub, err := ssh.ParsePublicKey(sig.PublicKey)
+	require.NoError(t, err)
+	var signature ssh.Signature
+	require.NoError(t, ssh.Unmarshal(sig.Signature, &signature))
+	hash := sha512.Sum512(message)
+	require.NoError(t, pub.Verify(sshsigBlob([]byte("git"), nil, []byte("sha512"), hash[:]), &signature))
+
+	return pub
+}
+
+// Test that SSH keys sign in the SSHSIG format, with SHA-2 signatures for RSA keys
+func Test_SSHSigner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inclusify-signing")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	path := filepath.Join(dir, "id_rsa")
+	require.NoError(t, ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)}), 0600))
+
+	signer, err := LoadSSH(path, "")
+	require.NoError(t, err)
+	message := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nUpdate references\n")
+	armored, err := signer.Sign(message)
+	require.NoError(t, err)
+	pub := verifySSHSIG(t, armored, message)
+	assert.Equal(t, ssh.KeyAlgoRSA, pub.Type())
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edSigner, err := ssh.NewSignerFromKey(edKey)
+	require.NoError(t, err)
+	armored, err = (&sshSigner{signer: edSigner}).Sign(message)
+	require.NoError(t, err)
+	pub = verifySSHSIG(t, armored, message)
+	assert.Equal(t, ssh.KeyAlgoED25519, pub.Type())
+}
+
+// Test that GPG keys are loaded with their private key, ready to sign
+func Test_LoadOpenPGP(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inclusify-signing")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	entity, err := openpgp.NewEntity("inclusify", "", "inclusify@example.com", nil)
+	require.NoError(t, err)
+	var key bytes.Buffer
+	require.NoError(t, entity.SerializePrivate(&key, nil))
+	path := filepath.Join(dir, "key.gpg")
+	require.NoError(t, ioutil.WriteFile(path, key.Bytes(), 0600))
+
+	loaded, err := LoadOpenPGP(path, "")
+	require.NoError(t, err)
+	assert.Equal(t, entity.PrimaryKey.KeyId, loaded.PrimaryKey.KeyId)
+	require.NotNil(t, loaded.PrivateKey)
+	assert.False(t, loaded.PrivateKey.Encrypted)
+
+	message := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n\nUpdate references\n")
+	var armored bytes.Buffer
+	require.NoError(t, openpgp.ArmoredDetachSign(&armored, loaded, bytes.NewReader(message), nil))
+	signedBy, err := openpgp.CheckArmoredDetachedSignature(openpgp.EntityList{entity}, bytes.NewReader(message), &armored, nil)
+	require.NoError(t, err)
+	assert.Equal(t, entity.PrimaryKey.KeyId, signedBy.PrimaryKey.KeyId)
+
+	_, err = LoadOpenPGP(filepath.Join(dir, "missing.gpg"), "")
+	assert.Error(t, err)
+	_, err = LoadSSH(path, "")
+	assert.Error(t, err)
+}
+
+// Test that signing formats are parsed in any case, with 'gpg' as an alias of 'openpgp'
+func Test_ParseFormat(t *testing.T) {
+	for input, want := range map[string]string{"": FormatOpenPGP, "gpg": FormatOpenPGP, "OpenPGP": FormatOpenPGP, "ssh": FormatSSH} {
+		got, err := ParseFormat(input)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	_, err := ParseFormat("x509")
+	assert.Error(t, err)
+}
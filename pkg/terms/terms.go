@@ -0,0 +1,206 @@
+package terms
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/hashicorp/inclusify/pkg/matcher"
+)
+
+// Severity levels of a term, which match the levels used by SARIF
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityNote    = "note"
+)
+
+// Entry is a single term in the dictionary, and what it should be replaced with.
+// Forms lists the other word forms of the term and their replacements, e.g.
+// {"slaves": "replicas"}. If Inflect is set, the plural, -ed and -ing forms are
+// also generated for both, which only works when both inflect regularly, e.g.
+// 'whitelisted' and 'allowlisted'. Forms take priority over generated ones.
+// ID, Description and Severity describe the rule reported for the term by scan.
+type Entry struct {
+	Term        string            `json:"term"`
+	Replacement string            `json:"replacement"`
+	Forms       map[string]string `json:"forms,omitempty"`
+	Inflect     bool              `json:"inflect,omitempty"`
+	ID          string            `json:"id,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Severity    string            `json:"severity,omitempty"`
+}
+
+// Dictionary is the format of a terms file, e.g.
+//
+//	{
+//	  "terms": [
+//	    {"term": "whitelist", "replacement": "allowlist"},
+//	    {"term": "sanity check", "replacement": "confidence check", "severity": "note"}
+//	  ]
+//	}
+type Dictionary struct {
+	Terms []Entry `json:"terms"`
+}
+
+// Load reads and validates the dictionary at path
+func Load(path string) ([]Entry, error) {
+	read, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read terms file: %w", err)
+	}
+
+	var d Dictionary
+	if err := json.Unmarshal(read, &d); err != nil {
+		return nil, fmt.Errorf("failed to parse terms file %s: %w", path, err)
+	}
+
+	for i, e := range d.Terms {
+		if strings.TrimSpace(e.Term) == "" || strings.TrimSpace(e.Replacement) == "" {
+			return nil, fmt.Errorf("term %d in %s must have both a term and a replacement", i+1, path)
+		}
+		switch e.Severity {
+		case "", SeverityError, SeverityWarning, SeverityNote:
+		default:
+			return nil, fmt.Errorf("term %d in %s has invalid severity %q, must be one of '%s', '%s' or '%s'", i+1, path, e.Severity, SeverityError, SeverityWarning, SeverityNote)
+		}
+	}
+
+	return d.Terms, nil
+}
+
+// BranchRuleID is the rule ID reported for references to the $base branch
+const BranchRuleID = "default-branch"
+
+// Branch returns the entry for renaming the $base branch to $target. Branch
+// names are never inflected, since 'mains' makes no sense.
+func Branch(base, target string) Entry {
+	return Entry{
+		Term:        base,
+		Replacement: target,
+		ID:          BranchRuleID,
+		Description: fmt.Sprintf("References to the '%s' branch should be updated to '%s'", base, target),
+	}
+}
+
+// RuleID returns the ID of the entry's rule, which defaults to the term in
+// kebab-case, e.g. 'sanity-check'
+func (e Entry) RuleID() string {
+	if e.ID != "" {
+		return e.ID
+	}
+	return strings.Join(strings.FieldsFunc(strings.ToLower(e.Term), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), "-")
+}
+
+// RuleSeverity returns the severity of the entry's rule, which defaults to a warning
+func (e Entry) RuleSeverity() string {
+	if e.Severity != "" {
+		return e.Severity
+	}
+	return SeverityWarning
+}
+
+// RuleDescription returns the description of the entry's rule
+func (e Entry) RuleDescription() string {
+	if e.Description != "" {
+		return e.Description
+	}
+	return fmt.Sprintf("'%s' should be replaced with '%s'", e.Term, e.Replacement)
+}
+
+// Expand returns the terms to match for the entry, including all of its word forms
+func (e Entry) Expand() []matcher.Term {
+	rule := e.RuleID()
+	expanded := []matcher.Term{{From: e.Term, To: e.Replacement, Rule: rule}}
+	seen := map[string]bool{e.Term: true}
+	add := func(from, to string) {
+		if from == "" || seen[from] {
+			return
+		}
+		seen[from] = true
+		expanded = append(expanded, matcher.Term{From: from, To: to, Rule: rule})
+	}
+
+	// Explicit forms take priority over generated ones
+	var forms []string
+	for from := range e.Forms {
+		forms = append(forms, from)
+	}
+	sort.Strings(forms)
+	for _, from := range forms {
+		add(from, e.Forms[from])
+	}
+	if e.Inflect {
+		for _, inflect := range []func(string) string{plural, past, gerund} {
+			add(inflectLast(e.Term, inflect), inflectLast(e.Replacement, inflect))
+		}
+	}
+
+	return expanded
+}
+
+// Expand returns the terms to match for all of the entries
+func Expand(entries []Entry) []matcher.Term {
+	var expanded []matcher.Term
+	for _, e := range entries {
+		expanded = append(expanded, e.Expand()...)
+	}
+	return expanded
+}
+
+// inflectLast applies inflect to the last word of a phrase, e.g. 'sanity checks'
+func inflectLast(phrase string, inflect func(string) string) string {
+	i := strings.LastIndexAny(phrase, " -_")
+	return phrase[:i+1] + inflect(phrase[i+1:])
+}
+
+func plural(word string) string {
+	switch {
+	case hasAnySuffix(word, "s", "x", "z", "ch", "sh"):
+		return word + "es"
+	case endsInConsonantY(word):
+		return word[:len(word)-1] + "ies"
+	}
+	return word + "s"
+}
+
+func past(word string) string {
+	switch {
+	case strings.HasSuffix(word, "e"):
+		return word + "d"
+	case endsInConsonantY(word):
+		return word[:len(word)-1] + "ied"
+	}
+	return word + "ed"
+}
+
+func gerund(word string) string {
+	switch {
+	case strings.HasSuffix(word, "ie"):
+		return word[:len(word)-2] + "ying"
+	case strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "ee"):
+		return word[:len(word)-1] + "ing"
+	}
+	return word + "ing"
+}
+
+func hasAnySuffix(word string, suffixes ...string) bool {
+	for _, s := range suffixes {
+		if strings.HasSuffix(word, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func endsInConsonantY(word string) bool {
+	if len(word) < 2 || !strings.HasSuffix(word, "y") {
+		return false
+	}
+	return !strings.ContainsRune("aeiou", rune(word[len(word)-2]))
+}
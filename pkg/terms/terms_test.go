@@ -0,0 +1,106 @@
+// +build !integration
+
+package terms
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hashicorp/inclusify/pkg/matcher"
+)
+
+// Test that entries with Inflect set are expanded into their plural, -ed and
+// -ing forms
+func Test_Expand(t *testing.T) {
+	cases := map[string][]matcher.Term{
+		"whitelist": {
+			{From: "whitelist", To: "allowlist", Rule: "whitelist"},
+			{From: "whitelists", To: "allowlists", Rule: "whitelist"},
+			{From: "whitelisted", To: "allowlisted", Rule: "whitelist"},
+			{From: "whitelisting", To: "allowlisting", Rule: "whitelist"},
+		},
+		"blackbox": {
+			{From: "blackbox", To: "opaque-box", Rule: "blackbox"},
+			{From: "blackboxes", To: "opaque-boxes", Rule: "blackbox"},
+			{From: "blackboxed", To: "opaque-boxed", Rule: "blackbox"},
+			{From: "blackboxing", To: "opaque-boxing", Rule: "blackbox"},
+		},
+		"deny": {
+			{From: "deny", To: "block", Rule: "deny"},
+			{From: "denies", To: "blocks", Rule: "deny"},
+			{From: "denied", To: "blocked", Rule: "deny"},
+			{From: "denying", To: "blocking", Rule: "deny"},
+		},
+		"sanity check": {
+			{From: "sanity check", To: "confidence check", Rule: "sanity-check"},
+			{From: "sanity checks", To: "confidence checks", Rule: "sanity-check"},
+			{From: "sanity checked", To: "confidence checked", Rule: "sanity-check"},
+			{From: "sanity checking", To: "confidence checking", Rule: "sanity-check"},
+		},
+	}
+	replacements := map[string]string{"whitelist": "allowlist", "blackbox": "opaque-box", "deny": "block", "sanity check": "confidence check"}
+
+	for term, want := range cases {
+		got := Entry{Term: term, Replacement: replacements[term], Inflect: true}.Expand()
+		assert.Equal(t, want, got, term)
+	}
+}
+
+// Test that only explicit forms are used unless Inflect is set, that they take
+// priority over generated ones, and that branch names are never inflected
+func Test_Expand_Forms(t *testing.T) {
+	e := Entry{Term: "slave", Replacement: "replica", Forms: map[string]string{"slaves": "replicas"}}
+	assert.Equal(t, []matcher.Term{{From: "slave", To: "replica", Rule: "slave"}, {From: "slaves", To: "replicas", Rule: "slave"}}, e.Expand())
+
+	e = Entry{Term: "dummy", Replacement: "placeholder", Inflect: true, Forms: map[string]string{"dummied": "stubbed", "dummying": "stubbing"}}
+	assert.Equal(t, []matcher.Term{
+		{From: "dummy", To: "placeholder", Rule: "dummy"},
+		{From: "dummied", To: "stubbed", Rule: "dummy"},
+		{From: "dummying", To: "stubbing", Rule: "dummy"},
+		{From: "dummies", To: "placeholders", Rule: "dummy"},
+	}, e.Expand())
+
+	assert.Equal(t, []matcher.Term{{From: "master", To: "main", Rule: BranchRuleID}}, Branch("master", "main").Expand())
+}
+
+// Test that a terms file is loaded and validated
+func Test_Load(t *testing.T) {
+	dir, err := ioutil.TempDir("", "inclusify-terms")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "terms.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"terms": [{"term": "blacklist", "replacement": "denylist"}]}`), 0644))
+	entries, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, []Entry{{Term: "blacklist", Replacement: "denylist"}}, entries)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"terms": [{"term": "blacklist"}]}`), 0644))
+	_, err = Load(path)
+	assert.Error(t, err)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"terms": [{"term": "blacklist", "replacement": "denylist", "severity": "fatal"}]}`), 0644))
+	_, err = Load(path)
+	assert.Error(t, err)
+
+	_, err = Load(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+// Test that rule metadata defaults are derived from the term
+func Test_Rule(t *testing.T) {
+	e := Entry{Term: "Sanity check", Replacement: "confidence check"}
+	assert.Equal(t, "sanity-check", e.RuleID())
+	assert.Equal(t, SeverityWarning, e.RuleSeverity())
+	assert.Equal(t, "'Sanity check' should be replaced with 'confidence check'", e.RuleDescription())
+
+	e = Entry{Term: "slave", Replacement: "replica", ID: "IL001", Severity: SeverityError, Description: "Use replica"}
+	assert.Equal(t, "IL001", e.RuleID())
+	assert.Equal(t, SeverityError, e.RuleSeverity())
+	assert.Equal(t, "Use replica", e.RuleDescription())
+}
@@ -3,12 +3,14 @@
 package tests
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"regexp"
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/dchest/uniuri"
 	"github.com/mitchellh/cli"
@@ -152,7 +154,7 @@ func Test_CreateScaffold(t *testing.T) {
 
 	// Make some assertions about the UI output
 	output := mockUI.OutputWriter.String()
-	assert.Contains(t, output, "Creating local temp dir: dirPrefix=tmp-clone-")
+	assert.Contains(t, output, "Creating workspace: dirPrefix=tmp-clone-")
 	assert.Contains(t, output, "Initializing new repo at dir: dir=")
 	assert.Contains(t, output, fmt.Sprintf("Creating a new remote for base: base=%s", base))
 	assert.Contains(t, output, "Copying test CI files into temp directory")
@@ -240,7 +242,7 @@ func Test_UpdateOpenPullRequestsNoOp(t *testing.T) {
 }
 
 // Test_UpdateRefs finds and replaces all references of 'master' to 'main' in the given CI files
-// in the 'update-references' branch, and opens a PR to merge changes from 'update-references' to 'main'
+// in a clone of 'main', pushes them to the 'update-references' branch, and opens a PR to merge changes from 'update-references' to 'main'
 // No files/dirs in `exclusions` is considered.
 func Test_UpdateRefs(t *testing.T) {
 	defer seq()()
@@ -272,12 +274,10 @@ func Test_UpdateRefs(t *testing.T) {
 	// Make some assertions about the UI output
 	output := mockUI.OutputWriter.String()
 	assert.Contains(t, output, fmt.Sprintf("Successfully cloned repo into local dir: repo=%s dir=", repo))
-	assert.Contains(t, output, fmt.Sprintf("Retrieved HEAD commit of branch: branch=%s", temp))
+	assert.Contains(t, output, fmt.Sprintf("Retrieved HEAD commit of branch: branch=%s", target))
 	assert.Contains(t, output, "Finding and replacing all references from base to target in dir")
-	assert.Contains(t, output, "Finding and replacing all references from base to target in dir")
-	assert.Contains(t, output, "Running `git add")
-	assert.Contains(t, output, "Committing changes")
-	assert.Contains(t, output, fmt.Sprintf("Pushing commit to remote: branch=%s sha=", temp))
+	assert.Contains(t, output, "Committing changes: category=")
+	assert.Contains(t, output, fmt.Sprintf("Pushing commits to remote: branch=%s commits=", temp))
 	assert.Contains(t, output, fmt.Sprintf("Creating PR to merge changes from branch into target: branch=%s target=%s", temp, target))
 	assert.Contains(t, output, fmt.Sprintf("Success! Review and merge the open PR: url=https://github.com/%s/%s/pull/", owner, repo))
 
@@ -291,6 +291,58 @@ func Test_UpdateRefs(t *testing.T) {
 	i.SetURL(url)
 }
 
+// Test_UpdateRefsRerun runs updateRefs again while the PR opened by TestUpdateRefs() is
+// still open. The changes are regenerated and force pushed to 'update-references', and
+// the same PR is updated instead of a new one being opened.
+func Test_UpdateRefsRerun(t *testing.T) {
+	defer seq()()
+	pullRequestURL := i.GetURL()
+	require.NotEmpty(t, pullRequestURL)
+	mockUI := cli.NewMockUi()
+	base := "master"
+	owner, repo, token, _, target, temp, _ := i.GetVals()
+	args := []string{"updateRefs", "--owner", owner, "--repo", repo, "--base", base, "--target", target, "--token", token}
+
+	// Parse and validate cmd line flags and env vars
+	config, err := config.ParseAndValidate(args, mockUI)
+	require.NoError(t, err)
+
+	client, err := gh.NewBaseGithubInteractor(token)
+	require.NoError(t, err)
+
+	// The lease is wherever the previous run left the branch
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ref, _, err := client.GetGit().GetRef(ctx, owner, repo, fmt.Sprintf("heads/%s", temp))
+	require.NoError(t, err)
+
+	command := &files.UpdateRefsCommand{
+		Config:       config,
+		GithubClient: client,
+		TempBranch:   temp,
+	}
+
+	exit := command.Run([]string{})
+
+	// Did we exit with a zero exit code?
+	if !assert.Equal(t, 0, exit) {
+		require.Fail(t, mockUI.ErrorWriter.String())
+	}
+
+	// Make some assertions about the UI output
+	output := mockUI.OutputWriter.String()
+	assert.Contains(t, output, fmt.Sprintf("Retrieved HEAD commit of branch: branch=%s", target))
+	assert.Contains(t, output, fmt.Sprintf("lease=%s", ref.GetObject().GetSHA()))
+	assert.Contains(t, output, fmt.Sprintf("Updating the PR that is already open for branch: branch=%s target=%s", temp, target))
+	assert.NotContains(t, output, "Creating PR to merge changes from branch into target")
+
+	// The same PR is printed
+	scheme := fmt.Sprintf(`(https:\/\/github.com\/%s\/%s\/pull\/)\d*`, owner, repo)
+	r, err := regexp.Compile(scheme)
+	require.NoError(t, err)
+	assert.Equal(t, pullRequestURL, r.FindString(output))
+}
+
 // Test_MergePullRequest merges the pull request created in TestUpdateRefs()
 func Test_MergePullRequest(t *testing.T) {
 	defer seq()()
@@ -333,8 +385,10 @@ func Test_MergePullRequest(t *testing.T) {
 }
 
 // Test_CreateOpenPullRequest finds and replaces all references of 'master' to 'master-clone'
-// in the given CI files, and pushes the changes to 'my-fancy-branch' branch + opens a PR.
-// This will let us test that we can successfully update the base branch of an open PR
+// in a clone of 'master-clone', and pushes the changes to 'my-fancy-branch' + opens a PR.
+// 'my-fancy-branch' already exists, since TestCreateBranches() created it off of 'master',
+// so it is replaced under a lease on its current commit. This will let us test that we
+// can successfully update the base branch of an open PR.
 func Test_CreateOpenPullRequest(t *testing.T) {
 	defer seq()()
 	mockUI := cli.NewMockUi()
@@ -348,6 +402,12 @@ func Test_CreateOpenPullRequest(t *testing.T) {
 	client, err := gh.NewBaseGithubInteractor(token)
 	require.NoError(t, err)
 
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	ref, _, err := client.GetGit().GetRef(ctx, owner, repo, fmt.Sprintf("heads/%s", random))
+	require.NoError(t, err)
+	lease := ref.GetObject().GetSHA()
+
 	command := &files.UpdateRefsCommand{
 		Config:       config,
 		GithubClient: client,
@@ -364,14 +424,19 @@ func Test_CreateOpenPullRequest(t *testing.T) {
 	// Make some assertions about the UI output
 	output := mockUI.OutputWriter.String()
 	assert.Contains(t, output, fmt.Sprintf("Successfully cloned repo into local dir: repo=%s dir=", repo))
-	assert.Contains(t, output, fmt.Sprintf("Retrieved HEAD commit of branch: branch=%s", random))
+	assert.Contains(t, output, fmt.Sprintf("Retrieved HEAD commit of branch: branch=%s", base))
 	assert.Contains(t, output, "Finding and replacing all references from base to target in dir")
-	assert.Contains(t, output, "Running `git add")
-	assert.Contains(t, output, "Committing changes")
-	assert.Contains(t, output, fmt.Sprintf("Pushing commit to remote: branch=%s sha=", random))
-	assert.Contains(t, output, fmt.Sprintf("Creating PR to merge changes from branch into target: branch=%s target=%s", random, "master"))
+	assert.Contains(t, output, "Committing changes: category=")
+	assert.Contains(t, output, fmt.Sprintf("Pushing commits to remote: branch=%s commits=", random))
+	assert.Contains(t, output, fmt.Sprintf("lease=%s", lease))
+	assert.Contains(t, output, fmt.Sprintf("Creating PR to merge changes from branch into target: branch=%s target=%s", random, base))
 	assert.Contains(t, output, fmt.Sprintf("Success! Review and merge the open PR: url=https://github.com/%s/%s/pull/", owner, repo))
 
+	// The branch created off of 'master' was replaced with the changes on top of 'master-clone'
+	ref, _, err = client.GetGit().GetRef(ctx, owner, repo, fmt.Sprintf("heads/%s", random))
+	require.NoError(t, err)
+	assert.NotEqual(t, lease, ref.GetObject().GetSHA())
+
 	// Extract pull request URL from output
 	scheme := fmt.Sprintf(`(https:\/\/github.com\/%s\/%s\/pull\/)\d*`, owner, repo)
 	r, err := regexp.Compile(scheme)
@@ -0,0 +1,147 @@
+package workspace
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+
+	"github.com/go-git/go-billy/v5/osfs"
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/cache"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/storage/filesystem"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// Options configure where a workspace lives and how its repo is stored
+type Options struct {
+	// Dir is the dir the workspace is created in. The OS temp dir is used if it's empty.
+	Dir string
+	// InMemoryObjects keeps the git objects and refs of the repo in memory, with
+	// go-git's memory storage. The working tree is still written to the workspace
+	// dir, since the files are rewritten in place.
+	InMemoryObjects bool
+	// Depth limits clones to this many commits from the tip of the cloned branch.
+	// 0 clones the whole history.
+	Depth int
+}
+
+// Workspace is a temp dir holding the working tree of a cloned or new repo. It
+// is removed by Close, or when the process is interrupted.
+type Workspace struct {
+	Dir  string
+	Repo *git.Repository
+
+	opts Options
+}
+
+// New creates an empty workspace in a new dir whose name starts with prefix
+func New(opts Options, prefix string) (ws *Workspace, err error) {
+	dir, err := ioutil.TempDir(opts.Dir, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace dir: %w", err)
+	}
+
+	ws = &Workspace{Dir: dir, opts: opts}
+	track(ws)
+
+	return ws, nil
+}
+
+// Clone clones the single branch in opts into the workspace, shallowly if a
+// depth is configured. opts is left unchanged.
+func (ws *Workspace) Clone(opts *git.CloneOptions) (err error) {
+	cloneOpts := *opts
+	cloneOpts.SingleBranch = true
+	cloneOpts.Depth = ws.opts.Depth
+
+	ws.Repo, err = git.Clone(ws.storage(), osfs.New(ws.Dir), &cloneOpts)
+	if err != nil {
+		return fmt.Errorf("failed to clone repo %s %s: %w", opts.URL, opts.ReferenceName, err)
+	}
+	return nil
+}
+
+// Init initializes a new repo in the workspace
+func (ws *Workspace) Init() (err error) {
+	ws.Repo, err = git.Init(ws.storage(), osfs.New(ws.Dir))
+	if err != nil {
+		return fmt.Errorf("failed to initialize new repo: %w", err)
+	}
+	return nil
+}
+
+// storage returns where the git objects and refs of the repo are stored
+func (ws *Workspace) storage() storage.Storer {
+	if ws.opts.InMemoryObjects {
+		return memory.NewStorage()
+	}
+	return filesystem.NewStorage(osfs.New(filepath.Join(ws.Dir, git.GitDirName)), cache.NewObjectLRUDefault())
+}
+
+// Close removes the workspace dir. It is safe to call more than once.
+func (ws *Workspace) Close() error {
+	untrack(ws)
+	if err := os.RemoveAll(ws.Dir); err != nil {
+		return fmt.Errorf("failed to remove workspace dir %s: %w", ws.Dir, err)
+	}
+	return nil
+}
+
+var (
+	mu      sync.Mutex
+	open    = map[*Workspace]bool{}
+	handler sync.Once
+)
+
+// track registers ws to be removed if the process is interrupted, and starts
+// listening for interrupts the first time it is called
+func track(ws *Workspace) {
+	mu.Lock()
+	open[ws] = true
+	mu.Unlock()
+
+	handler.Do(func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			sig := <-signals
+			CloseAll()
+			fmt.Fprintf(os.Stderr, "Removed workspaces after receiving %s\n", sig)
+			os.Exit(exitCode(sig))
+		}()
+	})
+}
+
+// exitCode returns the exit code of a process killed by sig, like shells report
+// it: 128 plus the signal number, e.g. 130 for SIGINT and 143 for SIGTERM
+func exitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
+func untrack(ws *Workspace) {
+	mu.Lock()
+	delete(open, ws)
+	mu.Unlock()
+}
+
+// CloseAll removes every workspace that hasn't been closed yet
+func CloseAll() {
+	mu.Lock()
+	var workspaces []*Workspace
+	for ws := range open {
+		workspaces = append(workspaces, ws)
+	}
+	mu.Unlock()
+
+	for _, ws := range workspaces {
+		ws.Close()
+	}
+}
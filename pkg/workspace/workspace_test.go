@@ -0,0 +1,122 @@
+// +build !integration
+
+package workspace
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestRemote creates a bare repo with a few commits on 'master' and 'other',
+// and returns its dir
+func newTestRemote(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "remote")
+	require.NoError(t, err)
+	src := filepath.Join(dir, "src")
+	repo, err := git.PlainInit(src, false)
+	require.NoError(t, err)
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+	for _, content := range []string{"one", "two", "three"} {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(src, "README.md"), []byte(content), 0644))
+		_, err = worktree.Add("README.md")
+		require.NoError(t, err)
+		_, err = worktree.Commit(content, &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}})
+		require.NoError(t, err)
+	}
+	head, err := repo.Head()
+	require.NoError(t, err)
+	require.NoError(t, repo.Storer.SetReference(plumbing.NewHashReference("refs/heads/other", head.Hash())))
+
+	bare := filepath.Join(dir, "remote.git")
+	_, err = git.PlainClone(bare, true, &git.CloneOptions{URL: src})
+	require.NoError(t, err)
+	return dir
+}
+
+// Test that shallow single-branch clones can be committed to and pushed, with
+// the repo on disk or in memory
+func Test_Workspace_Clone(t *testing.T) {
+	remote := newTestRemote(t)
+	defer os.RemoveAll(remote)
+	url := filepath.Join(remote, "remote.git")
+
+	for _, inMemoryObjects := range []bool{false, true} {
+		parent, err := ioutil.TempDir("", "workspaces")
+		require.NoError(t, err)
+		defer os.RemoveAll(parent)
+
+		ws, err := New(Options{Dir: parent, InMemoryObjects: inMemoryObjects, Depth: 1}, "tmp-clone-")
+		require.NoError(t, err)
+		require.NoError(t, ws.Clone(&git.CloneOptions{URL: url, ReferenceName: "refs/heads/master"}))
+
+		_, err = os.Stat(filepath.Join(ws.Dir, ".git"))
+		assert.Equal(t, inMemoryObjects, os.IsNotExist(err), "inMemoryObjects=%t", inMemoryObjects)
+		shallow, err := ws.Repo.Storer.Shallow()
+		require.NoError(t, err)
+		assert.Len(t, shallow, 1, "inMemoryObjects=%t", inMemoryObjects)
+		branches, err := ws.Repo.References()
+		require.NoError(t, err)
+		require.NoError(t, branches.ForEach(func(ref *plumbing.Reference) error {
+			assert.NotEqual(t, "other", ref.Name().Short())
+			return nil
+		}))
+
+		worktree, err := ws.Repo.Worktree()
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(ws.Dir, "README.md"), []byte("four"), 0644))
+		_, err = worktree.Add("README.md")
+		require.NoError(t, err)
+		sha, err := worktree.Commit("four", &git.CommitOptions{Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}})
+		require.NoError(t, err)
+		require.NoError(t, ws.Repo.Push(&git.PushOptions{}))
+
+		out, err := exec.Command("git", "--git-dir", url, "rev-parse", "master").Output()
+		require.NoError(t, err)
+		assert.Equal(t, sha.String()+"\n", string(out))
+
+		require.NoError(t, ws.Close())
+		require.NoError(t, ws.Close())
+		_, err = os.Stat(ws.Dir)
+		assert.True(t, os.IsNotExist(err))
+	}
+}
+
+// Test that the workspaces that are still open are removed at once, e.g. on SIGINT
+func Test_CloseAll(t *testing.T) {
+	parent, err := ioutil.TempDir("", "workspaces")
+	require.NoError(t, err)
+	defer os.RemoveAll(parent)
+
+	var dirs []string
+	for i := 0; i < 3; i++ {
+		ws, err := New(Options{Dir: parent}, "tmp-clone-")
+		require.NoError(t, err)
+		require.NoError(t, ws.Init())
+		dirs = append(dirs, ws.Dir)
+	}
+
+	CloseAll()
+	for _, dir := range dirs {
+		_, err := os.Stat(dir)
+		assert.True(t, os.IsNotExist(err), dir)
+	}
+	assert.Empty(t, open)
+}
+
+// Test that interrupts exit like shells report them, so CI runners show the cause
+func Test_exitCode(t *testing.T) {
+	assert.Equal(t, 130, exitCode(os.Interrupt))
+	assert.Equal(t, 143, exitCode(syscall.SIGTERM))
+}